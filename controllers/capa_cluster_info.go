@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CAPAClusterInfoResolver resolves clusters backed by an AWSCluster with the
+// same name.
+type CAPAClusterInfoResolver struct {
+	Client     client.Client
+	BaseDomain string
+}
+
+func (r *CAPAClusterInfoResolver) Resolve(ctx context.Context, cluster *capi.Cluster) (*ClusterInfo, error) {
+	awsCluster := &capa.AWSCluster{}
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(cluster), awsCluster)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	clusterInfo := &ClusterInfo{
+		AWSCluster:   awsCluster,
+		Name:         awsCluster.Name,
+		Namespace:    awsCluster.Namespace,
+		Region:       awsCluster.Spec.Region,
+		AWSPartition: getPartition(awsCluster.Spec.Region),
+		VpcID:        awsCluster.Spec.NetworkSpec.VPC.ID,
+	}
+
+	clusterInfo.RoleArn, err = getIdentityRoleARN(ctx, r.Client, awsCluster.Spec.IdentityRef, awsCluster.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cluster role identity")
+	}
+
+	// May not apply to all clusters (e.g. different in China region), so we prefer reading the actual values
+	// from the `AWSCluster` annotation
+	computedIRSADomain := "irsa." + clusterInfo.Name + "." + r.BaseDomain
+	irsaTrustDomains := getIRSATrustDomains(awsCluster, computedIRSADomain)
+	clusterInfo.OIDCDomain = irsaTrustDomains[0]
+	clusterInfo.OIDCDomains = irsaTrustDomains
+
+	clusterInfo.SecurityGroups = &crossplaneConfigValuesAWSClusterSecurityGroups{}
+
+	if sg, ok := awsCluster.Status.Network.SecurityGroups[capa.SecurityGroupControlPlane]; ok {
+		clusterInfo.SecurityGroups.ControlPlane = &crossplaneConfigValuesAWSClusterSecurityGroup{
+			ID: sg.ID,
+		}
+	}
+
+	if sg, ok := awsCluster.Status.Network.SecurityGroups[capa.SecurityGroupNode]; ok {
+		clusterInfo.SecurityGroups.Node = &crossplaneConfigValuesAWSClusterSecurityGroup{
+			ID: sg.ID,
+		}
+	}
+
+	clusterInfo.Missing = getMissingFields(map[string]bool{
+		VpcIDField:                     clusterInfo.VpcID != "",
+		ControlPlaneSecurityGroupField: clusterInfo.SecurityGroups.ControlPlane != nil && clusterInfo.SecurityGroups.ControlPlane.ID != "",
+		NodeSecurityGroupField:         clusterInfo.SecurityGroups.Node != nil && clusterInfo.SecurityGroups.Node.ID != "",
+	})
+
+	return clusterInfo, nil
+}
@@ -3,6 +3,8 @@ package controllers_test
 import (
 	"context"
 	"fmt"
+	"strings"
+	"text/template"
 
 	"github.com/aws/aws-sdk-go/aws/arn"
 	. "github.com/onsi/ginkgo/v2"
@@ -16,10 +18,14 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"sigs.k8s.io/yaml"
+
 	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/tests"
 )
 
 var _ = Describe("ConfigMapReconcilerCAPA", func() {
@@ -54,7 +60,15 @@ var _ = Describe("ConfigMapReconcilerCAPA", func() {
                 - irsa.%s.base.domain.io
                 region: the-region
                 awsPartition: aws
-            `, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name))))
+                ready: false
+                missing:
+                - awsCluster.securityGroups.controlPlane
+                - awsCluster.securityGroups.node
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name, cluster.Name, accountID))))
 	}
 
 	verifyProviderConfig := func() {
@@ -133,6 +147,39 @@ var _ = Describe("ConfigMapReconcilerCAPA", func() {
 		verifyProviderConfig()
 	})
 
+	It("creates the environment config", func() {
+		environmentConfig := &unstructured.Unstructured{}
+		environmentConfig.SetGroupVersionKind(schema.GroupVersionKind{
+			Group:   "apiextensions.crossplane.io",
+			Kind:    "EnvironmentConfig",
+			Version: "v1beta1",
+		})
+
+		err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, environmentConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(environmentConfig.GetLabels()).To(MatchKeys(IgnoreExtras, Keys{
+			controllers.ClusterNameLabel: Equal(cluster.Name),
+			controllers.AccountIDLabel:   Equal(accountID),
+			controllers.RegionLabel:      Equal("the-region"),
+		}))
+		Expect(environmentConfig.Object).To(HaveKeyWithValue("data", MatchAllKeys(Keys{
+			"accountID":    Equal(accountID),
+			"awsCluster":   HaveKeyWithValue("vpcId", "vpc-1"),
+			"awsPartition": Equal("aws"),
+			"baseDomain":   Equal(fmt.Sprintf("%s.base.domain.io", cluster.Name)),
+			"clusterName":  Equal(cluster.Name),
+			"oidcDomain":   Equal(fmt.Sprintf("irsa.%s.base.domain.io", cluster.Name)),
+			"oidcDomains":  ConsistOf(fmt.Sprintf("irsa.%s.base.domain.io", cluster.Name)),
+			"region":       Equal("the-region"),
+			"providerConfig": MatchAllKeys(Keys{
+				"name":              Equal(cluster.Name),
+				"credentialsSource": Equal("WebIdentity"),
+				"roleARN":           Equal(fmt.Sprintf("arn:aws:iam::%s:role/the-provider-role", accountID)),
+			}),
+		})))
+	})
+
 	When("the account id changes", func() {
 		BeforeEach(func() {
 			someOtherAccount := "1234567"
@@ -140,6 +187,9 @@ var _ = Describe("ConfigMapReconcilerCAPA", func() {
 				ObjectMeta: metav1.ObjectMeta{
 					Namespace: cluster.Namespace,
 					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+					Labels: map[string]string{
+						controllers.ManagedByLabel: controllers.ManagedByValue,
+					},
 				},
 			}
 			configMap.Data = map[string]string{
@@ -165,6 +215,9 @@ var _ = Describe("ConfigMapReconcilerCAPA", func() {
 				"metadata": map[string]interface{}{
 					"name":      cluster.Name,
 					"namespace": cluster.Namespace,
+					"labels": map[string]interface{}{
+						controllers.ManagedByLabel: controllers.ManagedByValue,
+					},
 				},
 				"spec": map[string]interface{}{
 					"credentials": map[string]interface{}{
@@ -191,173 +244,1836 @@ var _ = Describe("ConfigMapReconcilerCAPA", func() {
 		It("updates the provider config", func() {
 			verifyProviderConfig()
 		})
-	})
-
-	When("the cluster is deleted", func() {
-		BeforeEach(func() {
-			patchedCluster := cluster.DeepCopy()
-			patchedCluster.Finalizers = []string{controllers.Finalizer}
 
-			err := k8sClient.Patch(context.Background(), patchedCluster, client.MergeFrom(cluster))
+		// The objects above are only labelled as managed like the ones of
+		// releases before the cluster labels.
+		It("labels the objects with the cluster", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Labels).To(MatchKeys(IgnoreExtras, Keys{
+				controllers.ManagedByLabel:        Equal(controllers.ManagedByValue),
+				controllers.ClusterNameLabel:      Equal(cluster.Name),
+				controllers.ClusterNamespaceLabel: Equal(cluster.Namespace),
+			}))
 
-			err = k8sClient.Delete(context.Background(), cluster)
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(providerConfig.GetLabels()).To(MatchKeys(IgnoreExtras, Keys{
+				controllers.ManagedByLabel:        Equal(controllers.ManagedByValue),
+				controllers.ClusterNameLabel:      Equal(cluster.Name),
+				controllers.ClusterNamespaceLabel: Equal(cluster.Namespace),
+			}))
 
-			patchedCapaCluster := awsCluster.DeepCopy()
-			patchedCapaCluster.Finalizers = []string{controllers.Finalizer}
-
-			err = k8sClient.Patch(context.Background(), patchedCapaCluster, client.MergeFrom(awsCluster))
+			err = k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			}, cluster)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(conditions.IsTrue(cluster, controllers.ProviderConfigReadyCondition)).To(BeTrue())
+		})
+	})
 
-			err = k8sClient.Delete(context.Background(), awsCluster)
+	When("a config map not managed by the operator exists", func() {
+		BeforeEach(func() {
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				},
+				Data: map[string]string{
+					"values": "hand-written",
+				},
+			}
+			err := k8sClient.Create(ctx, configMap)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("removes the finalizer on Cluster", func() {
+		It("does not update the config map", func() {
+			configMap := &corev1.ConfigMap{}
 			err := k8sClient.Get(ctx, types.NamespacedName{
 				Namespace: cluster.Namespace,
-				Name:      cluster.Name,
-			}, cluster)
-			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue("values", "hand-written"))
+			Expect(configMap.Labels).NotTo(HaveKey(controllers.ManagedByLabel))
 		})
 
-		It("removes the finalizer on AWSCluster", func() {
+		It("reports the conflict on the cluster", func() {
 			err := k8sClient.Get(ctx, types.NamespacedName{
 				Namespace: cluster.Namespace,
 				Name:      cluster.Name,
-			}, awsCluster)
-			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+
+			condition := conditions.Get(cluster, controllers.ConfigMapReadyCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(controllers.OwnershipConflictReason))
 		})
 
-		It("removes the config map", func() {
-			configMap := &corev1.ConfigMap{}
-			err := k8sClient.Get(ctx, types.NamespacedName{
-				Namespace: cluster.Namespace,
-				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
-			}, configMap)
-			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		It("still creates the provider config", func() {
+			verifyProviderConfig()
 		})
 
-		It("removes the providerconfig", func() {
+		When("the config map has the adopt annotation", func() {
+			BeforeEach(func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+
+				configMap.Annotations = map[string]string{
+					controllers.AdoptAnnotation: "true",
+				}
+				err = k8sClient.Update(ctx, configMap)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("adopts and updates the config map", func() {
+				verifyConfigMap()
+
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configMap.Labels).To(HaveKeyWithValue(controllers.ManagedByLabel, controllers.ManagedByValue))
+			})
+		})
+	})
+
+	When("a provider config not managed by the operator exists", func() {
+		BeforeEach(func() {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.Object = map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": cluster.Name,
+				},
+				"spec": map[string]interface{}{
+					"credentials": map[string]interface{}{
+						"source": "WebIdentity",
+						"webIdentity": map[string]interface{}{
+							"roleARN": "arn:aws:iam::1234567:role/hand-written",
+						},
+					},
+				},
+			}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Create(ctx, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			providerConfig.SetName(cluster.Name)
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, providerConfig))).To(Succeed())
+		})
+
+		It("does not update the provider config", func() {
 			providerConfig := &unstructured.Unstructured{}
 			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
 				Group:   "aws.upbound.io",
 				Kind:    "ProviderConfig",
 				Version: "v1beta1",
 			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			roleARN, _, err := unstructured.NestedString(providerConfig.Object, "spec", "credentials", "webIdentity", "roleARN")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roleARN).To(Equal("arn:aws:iam::1234567:role/hand-written"))
+		})
 
+		It("reports the conflict on the cluster", func() {
 			err := k8sClient.Get(ctx, types.NamespacedName{
 				Namespace: cluster.Namespace,
 				Name:      cluster.Name,
-			}, providerConfig)
-			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+
+			condition := conditions.Get(cluster, controllers.ProviderConfigReadyCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(controllers.OwnershipConflictReason))
+		})
+
+		It("still creates the configmap", func() {
+			verifyConfigMap()
 		})
 	})
 
-	When("the cluster is in china", func() {
+	When("the names are configured through templates", func() {
+		var targetNamespace string
+
 		BeforeEach(func() {
-			awsCluster.Spec.Region = "cn-north-1"
-			err := k8sClient.Update(ctx, awsCluster)
-			Expect(err).NotTo(HaveOccurred())
+			targetNamespace = fmt.Sprintf("%s-apps", namespace)
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: targetNamespace},
+			})).To(Succeed())
+
+			reconciler.ConfigMapNameTemplate = "{{ .ClusterName }}-{{ .AccountID }}-values"
+			reconciler.ConfigMapNamespaceTemplate = targetNamespace
+			reconciler.ProviderConfigNameTemplate = "aws-{{ .ClusterName }}"
 		})
 
-		It("creates the configmap with the correct aws partition", func() {
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: targetNamespace},
+			})).To(Succeed())
+		})
+
+		It("creates the config map with the rendered name and namespace", func() {
 			configMap := &corev1.ConfigMap{}
 			err := k8sClient.Get(ctx, types.NamespacedName{
-				Namespace: cluster.Namespace,
-				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				Namespace: targetNamespace,
+				Name:      fmt.Sprintf("%s-%s-values", cluster.Name, accountID),
 			}, configMap)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(configMap.Data).To(HaveKeyWithValue("values", MatchYAML(fmt.Sprintf(`
-                accountID: "%s"
-                awsCluster:
-                  securityGroups: {}
-                  vpcId: vpc-1
-                baseDomain: %s.base.domain.io
-                oidcDomain: irsa.%s.base.domain.io
-                oidcDomains:
-                - irsa.%s.base.domain.io
-                clusterName: %s
-                region: cn-north-1
-                awsPartition: aws-cn
-            `, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name))))
+			Expect(configMap.Labels).To(HaveKeyWithValue(controllers.ClusterNameLabel, cluster.Name))
+			Expect(configMap.Labels).To(HaveKeyWithValue(controllers.ClusterNamespaceLabel, cluster.Namespace))
 		})
 
-		It("creates the provider config with the correct aws partition", func() {
+		It("creates the provider config with the rendered name", func() {
 			providerConfig := &unstructured.Unstructured{}
 			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
 				Group:   "aws.upbound.io",
 				Kind:    "ProviderConfig",
 				Version: "v1beta1",
 			})
-
-			err := k8sClient.Get(ctx, types.NamespacedName{
-				Namespace: cluster.Namespace,
-				Name:      cluster.Name,
-			}, providerConfig)
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("aws-%s", cluster.Name)}, providerConfig)
 			Expect(err).NotTo(HaveOccurred())
+		})
 
-			Expect(providerConfig.Object).To(HaveKeyWithValue("metadata", MatchKeys(IgnoreExtras, Keys{
-				"name": Equal(cluster.Name),
-			})))
-			Expect(providerConfig.Object).To(HaveKeyWithValue("spec", MatchKeys(IgnoreExtras, Keys{
-				"credentials": MatchKeys(IgnoreExtras, Keys{
-					"source": Equal("WebIdentity"),
-					"webIdentity": MatchKeys(IgnoreExtras, Keys{
-						"roleARN": Equal(fmt.Sprintf("arn:aws-cn:iam::%s:role/the-provider-role", accountID)),
-					}),
-				}),
-			})))
+		When("objects with the previous names exist", func() {
+			BeforeEach(func() {
+				previousReconciler := &controllers.ConfigMapReconciler{
+					Client:       k8sClient,
+					BaseDomain:   "base.domain.io",
+					ProviderRole: "the-provider-role",
+				}
+				_, err := previousReconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+				verifyConfigMap()
+				verifyProviderConfig()
+			})
+
+			It("deletes them", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				err = k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+
+		When("the cluster overrides the names with annotations", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.ConfigMapNameAnnotation:      "{{ .ClusterName }}-custom",
+					controllers.ConfigMapNamespaceAnnotation: "{{ .Namespace }}",
+					controllers.ProviderConfigNameAnnotation: "custom-{{ .ClusterName }}",
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("uses the names from the annotations", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-custom", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				err = k8sClient.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("custom-%s", cluster.Name)}, providerConfig)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the cluster sets an invalid name template annotation", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.ConfigMapNameAnnotation: "{{ .Labels.missing",
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("rejects the annotation", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      cluster.Name,
+				}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, conditionType := range []capi.ConditionType{controllers.ConfigMapReadyCondition, controllers.ProviderConfigReadyCondition} {
+					condition := conditions.Get(cluster, conditionType)
+					Expect(condition).NotTo(BeNil())
+					Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+					Expect(condition.Reason).To(Equal(controllers.InvalidAnnotationReason))
+				}
+			})
+
+			It("does not create the provider config", func() {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+
+		When("the cluster selects another namespace with the annotation", func() {
+			BeforeEach(func() {
+				reconciler.ConfigMapNamespaceTemplate = ""
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.ConfigMapNamespaceAnnotation: targetNamespace,
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("rejects the annotation", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      cluster.Name,
+				}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				condition := conditions.Get(cluster, controllers.ConfigMapReadyCondition)
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+				Expect(condition.Reason).To(Equal(controllers.InvalidAnnotationReason))
+
+				configMap := &corev1.ConfigMap{}
+				err = k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: targetNamespace,
+					Name:      fmt.Sprintf("%s-%s-values", cluster.Name, accountID),
+				}, configMap)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("still creates the provider config", func() {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("aws-%s", cluster.Name)}, providerConfig)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			When("the namespace is allowed", func() {
+				BeforeEach(func() {
+					reconciler.ConfigMapAllowedNamespaces = []string{targetNamespace}
+				})
+
+				It("creates the config map in the namespace", func() {
+					configMap := &corev1.ConfigMap{}
+					err := k8sClient.Get(ctx, types.NamespacedName{
+						Namespace: targetNamespace,
+						Name:      fmt.Sprintf("%s-%s-values", cluster.Name, accountID),
+					}, configMap)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+		})
+
+		When("the cluster is deleted", func() {
+			JustBeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Finalizers = []string{controllers.Finalizer}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+
+				err = k8sClient.Delete(ctx, cluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = reconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes the config map from the target namespace", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: targetNamespace,
+					Name:      fmt.Sprintf("%s-%s-values", cluster.Name, accountID),
+				}, configMap)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("removes the provider config", func() {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("aws-%s", cluster.Name)}, providerConfig)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("removes the environment config", func() {
+				environmentConfig := &unstructured.Unstructured{}
+				environmentConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "apiextensions.crossplane.io",
+					Kind:    "EnvironmentConfig",
+					Version: "v1beta1",
+				})
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, environmentConfig)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
 		})
 	})
 
-	When("the cluster is provisioned by CAPA", func() {
+	When("values templates are configured", func() {
 		BeforeEach(func() {
-			awsCluster.Spec.NetworkSpec.VPC.ID = "vpc-123456"
-			err := k8sClient.Update(ctx, awsCluster)
-			Expect(err).NotTo(HaveOccurred())
-
-			awsCluster.Status.Network.SecurityGroups = map[capa.SecurityGroupRole]capa.SecurityGroup{
-				capa.SecurityGroupControlPlane: {
-					ID: "sg-789987",
-				},
-				capa.SecurityGroupNode: {
-					ID: "sg-898989",
-				},
+			templates := map[string]string{
+				"vpc":          "{{ .AWSCluster.Spec.NetworkSpec.VPC.ID }}",
+				"account.yaml": "accountID: {{ .Values.AccountID | quote }}\ncluster: {{ .Cluster.Name | upper }}",
+				"broken":       "{{ .AWSManagedControlPlane.Spec.Region }}",
+			}
+			reconciler.ValuesTemplates = map[string]*template.Template{}
+			for key, text := range templates {
+				tmpl, err := controllers.ParseValuesTemplate(key, text)
+				Expect(err).NotTo(HaveOccurred())
+				reconciler.ValuesTemplates[key] = tmpl
 			}
-			err = k8sClient.Status().Update(ctx, awsCluster)
-			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("creates the configmap with the correct VPC ID and security group ID(s)", func() {
+		It("renders the templates into additional keys", func() {
+			verifyConfigMap()
+
 			configMap := &corev1.ConfigMap{}
 			err := k8sClient.Get(ctx, types.NamespacedName{
 				Namespace: cluster.Namespace,
 				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
 			}, configMap)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(configMap.Data).To(HaveKeyWithValue("values", MatchYAML(fmt.Sprintf(`
+			Expect(configMap.Data).To(HaveKeyWithValue("vpc", "vpc-1"))
+			Expect(configMap.Data).To(HaveKeyWithValue("account.yaml", MatchYAML(fmt.Sprintf(`
                 accountID: "%s"
-                awsCluster:
-                  securityGroups:
-                    controlPlane:
-                      id: sg-789987
-                    node:
-                      id: sg-898989
-                  vpcId: vpc-123456
-                awsPartition: aws
-                baseDomain: %s.base.domain.io
-                oidcDomain: irsa.%s.base.domain.io
-                oidcDomains:
-                - irsa.%s.base.domain.io
-                clusterName: %s
-                region: the-region
-            `, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name))))
+                cluster: %s
+            `, accountID, strings.ToUpper(cluster.Name)))))
+			Expect(configMap.Data).NotTo(HaveKey("broken"))
+		})
+
+		It("reports the failed template on the cluster", func() {
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+
+			condition := conditions.Get(cluster, controllers.ValuesTemplatesRenderedCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(controllers.TemplateRenderFailedReason))
+			Expect(condition.Message).To(ContainSubstring("broken"))
+
+			Expect(conditions.IsTrue(cluster, controllers.ConfigMapReadyCondition)).To(BeTrue())
 		})
 	})
 
-	When("the cluster has multiple service account issuers defined by an annotation", func() {
+	When("additional output formats are configured", func() {
+		BeforeEach(func() {
+			reconciler.OutputFormats = []controllers.OutputFormat{
+				controllers.OutputFormatJSON,
+				controllers.OutputFormatEnv,
+			}
+		})
+
+		It("writes the values in all formats", func() {
+			verifyConfigMap()
+
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue(controllers.ValuesJSONKey, MatchJSON(fmt.Sprintf(`{
+                "accountID": "%s",
+                "awsCluster": {"securityGroups": {}, "vpcId": "vpc-1"},
+                "awsPartition": "aws",
+                "baseDomain": "%s.base.domain.io",
+                "clusterName": "%s",
+                "oidcDomain": "irsa.%s.base.domain.io",
+                "oidcDomains": ["irsa.%s.base.domain.io"],
+                "region": "the-region",
+                "ready": false,
+                "missing": ["awsCluster.securityGroups.controlPlane", "awsCluster.securityGroups.node"],
+                "providerConfig": {
+                  "credentialsSource": "WebIdentity",
+                  "name": "%s",
+                  "roleARN": "arn:aws:iam::%s:role/the-provider-role"
+                }
+            }`, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name, cluster.Name, accountID))))
+			Expect(configMap.Data).To(HaveKeyWithValue(controllers.ValuesEnvKey, And(
+				ContainSubstring(fmt.Sprintf("AWS_ACCOUNT_ID=%s\n", accountID)),
+				ContainSubstring("VPC_ID=vpc-1\n"),
+				ContainSubstring(fmt.Sprintf("CLUSTER_NAME=%s\n", cluster.Name)),
+			)))
+			Expect(configMap.Data).NotTo(HaveKey("AWS_ACCOUNT_ID"))
+		})
+
+		When("the cluster overrides the output formats", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.OutputFormatsAnnotation: "flat",
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("only writes the formats from the annotation", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configMap.Data).To(HaveKeyWithValue("AWS_ACCOUNT_ID", accountID))
+				Expect(configMap.Data).To(HaveKeyWithValue("VPC_ID", "vpc-1"))
+				Expect(configMap.Data).To(HaveKeyWithValue("AWS_REGION", "the-region"))
+				Expect(configMap.Data).To(HaveKey(controllers.ValuesKey))
+				Expect(configMap.Data).NotTo(HaveKey(controllers.ValuesJSONKey))
+				Expect(configMap.Data).NotTo(HaveKey(controllers.ValuesEnvKey))
+			})
+		})
+	})
+
+	Describe("credentials sources", func() {
+		getSpec := func() map[string]interface{} {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			spec, ok := providerConfig.Object["spec"].(map[string]interface{})
+			Expect(ok).To(BeTrue())
+			return spec
+		}
+
+		roleARN := func() string {
+			return fmt.Sprintf("arn:aws:iam::%s:role/the-provider-role", accountID)
+		}
+
+		When("the source is WebIdentity", func() {
+			BeforeEach(func() {
+				reconciler.CredentialsSource = controllers.CredentialsSourceWebIdentity
+			})
+
+			It("uses the provider role as web identity", func() {
+				Expect(getSpec()).To(MatchAllKeys(Keys{
+					"credentials": MatchAllKeys(Keys{
+						"source": Equal("WebIdentity"),
+						"webIdentity": MatchAllKeys(Keys{
+							"roleARN": Equal(roleARN()),
+						}),
+					}),
+				}))
+			})
+		})
+
+		When("the source is IRSA", func() {
+			BeforeEach(func() {
+				reconciler.CredentialsSource = controllers.CredentialsSourceIRSA
+			})
+
+			It("assumes the provider role from the IRSA role", func() {
+				Expect(getSpec()).To(MatchAllKeys(Keys{
+					"credentials": MatchAllKeys(Keys{
+						"source": Equal("IRSA"),
+					}),
+					"assumeRoleChain": ConsistOf(MatchAllKeys(Keys{
+						"roleARN": Equal(roleARN()),
+					})),
+				}))
+			})
+		})
+
+		When("the source is Secret", func() {
+			BeforeEach(func() {
+				reconciler.CredentialsSource = controllers.CredentialsSourceSecret
+				reconciler.CredentialsSecret = "crossplane/aws-creds"
+			})
+
+			It("references the credentials secret", func() {
+				Expect(getSpec()).To(MatchAllKeys(Keys{
+					"credentials": MatchAllKeys(Keys{
+						"source": Equal("Secret"),
+						"secretRef": MatchAllKeys(Keys{
+							"namespace": Equal("crossplane"),
+							"name":      Equal("aws-creds"),
+							"key":       Equal(controllers.DefaultCredentialsSecretKey),
+						}),
+					}),
+				}))
+			})
+
+			When("the provider config is namespaced", func() {
+				BeforeEach(func() {
+					var err error
+					reconciler.ProviderConfigKind, reconciler.ProviderConfigVersion, err = controllers.ParseProviderConfigAPI("ProviderConfig.aws.m.upbound.io")
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				getNamespacedProviderConfig := func() (*unstructured.Unstructured, error) {
+					providerConfig := &unstructured.Unstructured{}
+					providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+						Group:   "aws.m.upbound.io",
+						Kind:    "ProviderConfig",
+						Version: "v1beta1",
+					})
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, providerConfig)
+					return providerConfig, err
+				}
+
+				It("rejects the secret in another namespace", func() {
+					_, err := getNamespacedProviderConfig()
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+					actualCluster := &capi.Cluster{}
+					err = k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, actualCluster)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(conditions.GetReason(actualCluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+				})
+
+				When("the secret has no namespace", func() {
+					BeforeEach(func() {
+						reconciler.CredentialsSecret = "aws-creds"
+					})
+
+					It("references the secret in its own namespace", func() {
+						providerConfig, err := getNamespacedProviderConfig()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(providerConfig.Object).To(HaveKeyWithValue("spec", MatchAllKeys(Keys{
+							"credentials": MatchAllKeys(Keys{
+								"source": Equal("Secret"),
+								"secretRef": MatchAllKeys(Keys{
+									"namespace": Equal(cluster.Namespace),
+									"name":      Equal("aws-creds"),
+									"key":       Equal(controllers.DefaultCredentialsSecretKey),
+								}),
+							}),
+						})))
+					})
+				})
+			})
+
+			When("no secret is configured", func() {
+				BeforeEach(func() {
+					reconciler.CredentialsSecret = ""
+				})
+
+				It("reports invalid credentials", func() {
+					err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+				})
+			})
+		})
+
+		When("the cluster overrides the source with annotations", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.CredentialsSourceAnnotation: "Secret",
+					controllers.CredentialsSecretAnnotation: "cluster-creds",
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("uses the source and secret from the annotations", func() {
+				Expect(getSpec()).To(MatchAllKeys(Keys{
+					"credentials": MatchAllKeys(Keys{
+						"source": Equal("Secret"),
+						"secretRef": MatchAllKeys(Keys{
+							"namespace": Equal(cluster.Namespace),
+							"name":      Equal("cluster-creds"),
+							"key":       Equal(controllers.DefaultCredentialsSecretKey),
+						}),
+					}),
+				}))
+			})
+		})
+
+		When("the cluster has an invalid source annotation", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.CredentialsSourceAnnotation: "Magic",
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("reports invalid credentials", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conditions.IsFalse(cluster, controllers.ProviderConfigReadyCondition)).To(BeTrue())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+			})
+
+			It("still creates the configmap", func() {
+				verifyConfigMap()
+			})
+		})
+	})
+
+	Describe("provider role templates", func() {
+		getRoleARN := func() string {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			roleARN, _, err := unstructured.NestedString(providerConfig.Object, "spec", "credentials", "webIdentity", "roleARN")
+			Expect(err).NotTo(HaveOccurred())
+			return roleARN
+		}
+
+		When("the role is a full ARN template", func() {
+			BeforeEach(func() {
+				reconciler.ProviderRole = "arn:{{ .Partition }}:iam::{{ .AccountID }}:role/crossplane/{{ .Namespace }}/{{ .ClusterName }}-{{ .Region }}"
+			})
+
+			It("renders the ARN", func() {
+				Expect(getRoleARN()).To(Equal(fmt.Sprintf("arn:aws:iam::%s:role/crossplane/%s/%s-the-region", accountID, cluster.Namespace, cluster.Name)))
+			})
+		})
+
+		When("the role is a role name with a path", func() {
+			BeforeEach(func() {
+				reconciler.ProviderRole = "crossplane/{{ .ClusterName }}"
+			})
+
+			It("builds the ARN in the cluster account", func() {
+				Expect(getRoleARN()).To(Equal(fmt.Sprintf("arn:aws:iam::%s:role/crossplane/%s", accountID, cluster.Name)))
+			})
+		})
+
+		When("the role is a fixed ARN", func() {
+			BeforeEach(func() {
+				reconciler.ProviderRole = "arn:aws:iam::999999999999:role/shared-crossplane"
+			})
+
+			It("uses the ARN as is", func() {
+				Expect(getRoleARN()).To(Equal("arn:aws:iam::999999999999:role/shared-crossplane"))
+			})
+		})
+
+		When("the cluster is in GovCloud", func() {
+			BeforeEach(func() {
+				awsCluster.Spec.Region = "us-gov-west-1"
+				err := k8sClient.Update(ctx, awsCluster)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			When("the role is a full ARN template", func() {
+				BeforeEach(func() {
+					reconciler.ProviderRole = "arn:{{ .Partition }}:iam::{{ .AccountID }}:role/crossplane"
+				})
+
+				It("renders the GovCloud partition", func() {
+					Expect(getRoleARN()).To(Equal(fmt.Sprintf("arn:aws-us-gov:iam::%s:role/crossplane", accountID)))
+				})
+			})
+
+			When("the role is a fixed GovCloud ARN", func() {
+				BeforeEach(func() {
+					reconciler.ProviderRole = "arn:aws-us-gov:iam::999999999999:role/shared-crossplane"
+				})
+
+				It("uses the ARN as is", func() {
+					Expect(getRoleARN()).To(Equal("arn:aws-us-gov:iam::999999999999:role/shared-crossplane"))
+				})
+			})
+		})
+
+		When("the role renders to an invalid ARN", func() {
+			BeforeEach(func() {
+				reconciler.ProviderRole = "arn:aws:s3:::{{ .ClusterName }}"
+			})
+
+			It("reports invalid credentials", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+			})
+		})
+
+		When("the role template uses an unknown field", func() {
+			BeforeEach(func() {
+				reconciler.ProviderRole = "{{ .Cluster }}"
+			})
+
+			It("reports invalid credentials", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+			})
+		})
+	})
+
+	When("the cluster overrides the account and provider role with annotations", func() {
+		BeforeEach(func() {
+			patchedCluster := cluster.DeepCopy()
+			patchedCluster.Annotations = map[string]string{
+				controllers.AccountIDAnnotation:    "210987654321",
+				controllers.ProviderRoleAnnotation: "crossplane/dedicated",
+			}
+			err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("uses the overrides in the provider config", func() {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			roleARN, _, err := unstructured.NestedString(providerConfig.Object, "spec", "credentials", "webIdentity", "roleARN")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roleARN).To(Equal("arn:aws:iam::210987654321:role/crossplane/dedicated"))
+		})
+
+		It("shows the effective values in the configmap", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue("values", SatisfyAll(
+				ContainSubstring(`accountID: "210987654321"`),
+				ContainSubstring("credentialsSource: WebIdentity"),
+				ContainSubstring("roleARN: arn:aws:iam::210987654321:role/crossplane/dedicated"),
+			)))
+		})
+	})
+
+	When("the cluster has an invalid account id annotation", func() {
+		BeforeEach(func() {
+			patchedCluster := cluster.DeepCopy()
+			patchedCluster.Annotations = map[string]string{
+				controllers.AccountIDAnnotation: "not-an-account",
+			}
+			err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects the annotation", func() {
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conditions.GetReason(cluster, controllers.ConfigMapReadyCondition)).To(Equal(controllers.InvalidAnnotationReason))
+			Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidAnnotationReason))
+		})
+
+		It("does not create the configmap", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+
+	When("the provider config api is overridden", func() {
+		getProviderConfig := func(gvk schema.GroupVersionKind, namespace string) (*unstructured.Unstructured, error) {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(gvk)
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: cluster.Name}, providerConfig)
+			return providerConfig, err
+		}
+
+		verifySpec := func(providerConfig *unstructured.Unstructured) {
+			Expect(providerConfig.Object).To(HaveKeyWithValue("spec", MatchKeys(IgnoreExtras, Keys{
+				"credentials": MatchKeys(IgnoreExtras, Keys{
+					"source": Equal("WebIdentity"),
+					"webIdentity": MatchKeys(IgnoreExtras, Keys{
+						"roleARN": Equal(fmt.Sprintf("arn:aws:iam::%s:role/the-provider-role", accountID)),
+					}),
+				}),
+			})))
+		}
+
+		BeforeEach(func() {
+			// Reconcile once with the discovered default kind, so the
+			// override switches kinds
+			_, err := reconciler.Reconcile(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		When("it is the cluster scoped ClusterProviderConfig", func() {
+			BeforeEach(func() {
+				var err error
+				reconciler.ProviderConfigKind, reconciler.ProviderConfigVersion, err = controllers.ParseProviderConfigAPI("ClusterProviderConfig.aws.m.upbound.io")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("creates a ClusterProviderConfig", func() {
+				providerConfig, err := getProviderConfig(schema.GroupVersionKind{
+					Group:   "aws.m.upbound.io",
+					Kind:    "ClusterProviderConfig",
+					Version: "v1beta1",
+				}, "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(providerConfig.GetNamespace()).To(BeEmpty())
+				verifySpec(providerConfig)
+			})
+
+			It("deletes the provider config of the previous kind", func() {
+				_, err := getProviderConfig(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				}, "")
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+
+		When("it is the namespaced ProviderConfig", func() {
+			BeforeEach(func() {
+				var err error
+				reconciler.ProviderConfigKind, reconciler.ProviderConfigVersion, err = controllers.ParseProviderConfigAPI("ProviderConfig.v1beta1.aws.m.upbound.io")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("creates the ProviderConfig in the namespace of the cluster", func() {
+				providerConfig, err := getProviderConfig(schema.GroupVersionKind{
+					Group:   "aws.m.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				}, cluster.Namespace)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(providerConfig.GetNamespace()).To(Equal(cluster.Namespace))
+				verifySpec(providerConfig)
+			})
+
+			When("the cluster is deleted", func() {
+				JustBeforeEach(func() {
+					patchedCluster := cluster.DeepCopy()
+					patchedCluster.Finalizers = []string{controllers.Finalizer}
+					err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+					Expect(err).NotTo(HaveOccurred())
+
+					err = k8sClient.Delete(ctx, cluster)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = reconciler.Reconcile(ctx, request)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("removes the ProviderConfig", func() {
+					_, err := getProviderConfig(schema.GroupVersionKind{
+						Group:   "aws.m.upbound.io",
+						Kind:    "ProviderConfig",
+						Version: "v1beta1",
+					}, cluster.Namespace)
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	When("the provider config api is not served", func() {
+		BeforeEach(func() {
+			reconciler.ProviderConfigKind, reconciler.ProviderConfigVersion = schema.GroupKind{
+				Group: "aws.upbound.io",
+				Kind:  "ProviderConfig",
+			}, "v9"
+		})
+
+		It("reports the provider config as unavailable", func() {
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conditions.IsFalse(cluster, controllers.ProviderConfigReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.ProviderConfigAPIUnavailableReason))
+		})
+
+		It("still creates the configmap", func() {
+			verifyConfigMap()
+		})
+	})
+
+	When("the control plane is not initialized", func() {
+		It("does not create the workload provider configs", func() {
+			for _, gvk := range []schema.GroupVersionKind{
+				{Group: "kubernetes.crossplane.io", Kind: "ProviderConfig", Version: "v1alpha1"},
+				{Group: "helm.crossplane.io", Kind: "ProviderConfig", Version: "v1beta1"},
+			} {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(gvk)
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			}
+
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conditions.GetReason(cluster, controllers.WorkloadProviderConfigsReadyCondition)).To(Equal(controllers.ControlPlaneNotInitializedReason))
+		})
+	})
+
+	When("the control plane is initialized", func() {
+		workloadProviderConfigGVKs := []schema.GroupVersionKind{
+			{Group: "kubernetes.crossplane.io", Kind: "ProviderConfig", Version: "v1alpha1"},
+			{Group: "helm.crossplane.io", Kind: "ProviderConfig", Version: "v1beta1"},
+		}
+
+		BeforeEach(func() {
+			tests.PatchCAPIClusterStatus(k8sClient, cluster, capi.ClusterStatus{
+				Phase: "Running",
+				Conditions: capi.Conditions{
+					{
+						Type:               capi.ControlPlaneInitializedCondition,
+						Status:             corev1.ConditionTrue,
+						LastTransitionTime: metav1.Now(),
+					},
+				},
+			})
+		})
+
+		It("creates the workload provider configs", func() {
+			for _, gvk := range workloadProviderConfigGVKs {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(gvk)
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(providerConfig.GetLabels()).To(MatchKeys(IgnoreExtras, Keys{
+					controllers.ManagedByLabel:   Equal(controllers.ManagedByValue),
+					controllers.ClusterNameLabel: Equal(cluster.Name),
+				}))
+				Expect(providerConfig.Object).To(HaveKeyWithValue("spec", MatchKeys(IgnoreExtras, Keys{
+					"credentials": MatchAllKeys(Keys{
+						"source": Equal("Secret"),
+						"secretRef": MatchAllKeys(Keys{
+							"namespace": Equal(cluster.Namespace),
+							"name":      Equal(fmt.Sprintf("%s-kubeconfig", cluster.Name)),
+							"key":       Equal("value"),
+						}),
+					}),
+				})))
+			}
+
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conditions.IsTrue(cluster, controllers.WorkloadProviderConfigsReadyCondition)).To(BeTrue())
+		})
+
+		When("the cluster is deleted", func() {
+			JustBeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Finalizers = []string{controllers.Finalizer}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+
+				err = k8sClient.Delete(ctx, cluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = reconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes the workload provider configs", func() {
+				for _, gvk := range workloadProviderConfigGVKs {
+					providerConfig := &unstructured.Unstructured{}
+					providerConfig.SetGroupVersionKind(gvk)
+					err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				}
+			})
+		})
+	})
+
+	Describe("provider config variants", func() {
+		getProviderConfig := func(name string) (*unstructured.Unstructured, error) {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: name}, providerConfig)
+			return providerConfig, err
+		}
+
+		BeforeEach(func() {
+			var err error
+			reconciler.ProviderConfigVariants, err = controllers.ParseProviderConfigVariants(`
+- suffix: readonly
+  role: crossplane-readonly-{{ .ClusterName }}
+  assumeRoleChain:
+  - arn:aws:iam::999999999999:role/audit
+- suffix: admin
+`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates a provider config per variant", func() {
+			providerConfig, err := getProviderConfig(cluster.Name + "-readonly")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(providerConfig.Object).To(HaveKeyWithValue("spec", MatchAllKeys(Keys{
+				"credentials": MatchAllKeys(Keys{
+					"source": Equal("WebIdentity"),
+					"webIdentity": MatchAllKeys(Keys{
+						"roleARN": Equal(fmt.Sprintf("arn:aws:iam::%s:role/crossplane-readonly-%s", accountID, cluster.Name)),
+					}),
+				}),
+				"assumeRoleChain": ConsistOf(MatchAllKeys(Keys{
+					"roleARN": Equal("arn:aws:iam::999999999999:role/audit"),
+				})),
+			})))
+
+			providerConfig, err = getProviderConfig(cluster.Name + "-admin")
+			Expect(err).NotTo(HaveOccurred())
+			roleARN, _, err := unstructured.NestedString(providerConfig.Object, "spec", "credentials", "webIdentity", "roleARN")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roleARN).To(Equal(fmt.Sprintf("arn:aws:iam::%s:role/the-provider-role", accountID)))
+
+			_, err = getProviderConfig(cluster.Name)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("lists the variants in the configmap", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue("values", SatisfyAll(
+				ContainSubstring(fmt.Sprintf("name: %s-readonly", cluster.Name)),
+				ContainSubstring(fmt.Sprintf("name: %s-admin", cluster.Name)),
+			)))
+		})
+
+		When("the cluster declares its own variants", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.ProviderConfigVariantsAnnotation: `[{"suffix": "deploy", "role": "crossplane-deploy"}]`,
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("replaces the global variants", func() {
+				_, err := getProviderConfig(cluster.Name + "-deploy")
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = getProviderConfig(cluster.Name + "-readonly")
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+
+		When("the cluster has invalid variants", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.ProviderConfigVariantsAnnotation: `[{"suffix": "Not_A_Label"}]`,
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("reports invalid credentials", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+			})
+		})
+
+		When("a variant is removed", func() {
+			JustBeforeEach(func() {
+				reconciler.ProviderConfigVariants = reconciler.ProviderConfigVariants[:1]
+				_, err := reconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("deletes its provider config", func() {
+				_, err := getProviderConfig(cluster.Name + "-admin")
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+				_, err = getProviderConfig(cluster.Name + "-readonly")
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		When("the cluster is deleted", func() {
+			JustBeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Finalizers = []string{controllers.Finalizer}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+
+				err = k8sClient.Delete(ctx, cluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = reconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("removes all provider configs of the cluster", func() {
+				for _, name := range []string{cluster.Name, cluster.Name + "-readonly", cluster.Name + "-admin"} {
+					_, err := getProviderConfig(name)
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				}
+			})
+		})
+	})
+
+	Describe("label and annotation propagation", func() {
+		getConfigMap := func() *corev1.ConfigMap {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			return configMap
+		}
+
+		getProviderConfig := func() *unstructured.Unstructured {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+			return providerConfig
+		}
+
+		BeforeEach(func() {
+			reconciler.PropagateLabels = []string{"giantswarm.io/organization", "release.giantswarm.io/*"}
+			reconciler.PropagateAnnotations = []string{"release.giantswarm.io/*"}
+
+			patchedCluster := cluster.DeepCopy()
+			patchedCluster.Labels = map[string]string{
+				"giantswarm.io/organization":     "acme",
+				"release.giantswarm.io/version":  "30.0.0",
+				"giantswarm.io/service-priority": "highest",
+			}
+			patchedCluster.Annotations = map[string]string{
+				"release.giantswarm.io/notes": "upgrade",
+				"giantswarm.io/notes":         "not copied",
+			}
+			err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("copies the allow-listed labels and the standard labels", func() {
+			expectedLabels := MatchKeys(IgnoreExtras, Keys{
+				"giantswarm.io/organization":    Equal("acme"),
+				"release.giantswarm.io/version": Equal("30.0.0"),
+				controllers.ClusterNameLabel:    Equal(cluster.Name),
+				controllers.AccountIDLabel:      Equal(accountID),
+				controllers.RegionLabel:         Equal("the-region"),
+			})
+			Expect(getConfigMap().Labels).To(expectedLabels)
+			Expect(getConfigMap().Labels).NotTo(HaveKey("giantswarm.io/service-priority"))
+			Expect(getProviderConfig().GetLabels()).To(expectedLabels)
+		})
+
+		It("copies the allow-listed annotations", func() {
+			Expect(getConfigMap().Annotations).To(HaveKeyWithValue("release.giantswarm.io/notes", "upgrade"))
+			Expect(getConfigMap().Annotations).NotTo(HaveKey("giantswarm.io/notes"))
+			Expect(getProviderConfig().GetAnnotations()).To(HaveKeyWithValue("release.giantswarm.io/notes", "upgrade"))
+		})
+
+		When("the cluster labels change", func() {
+			JustBeforeEach(func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Labels = map[string]string{
+					"giantswarm.io/organization": "other",
+				}
+				patchedCluster.Annotations = map[string]string{}
+				err = k8sClient.Update(ctx, patchedCluster)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = reconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("keeps the generated objects in sync", func() {
+				for _, object := range []client.Object{getConfigMap(), getProviderConfig()} {
+					Expect(object.GetLabels()).To(HaveKeyWithValue("giantswarm.io/organization", "other"))
+					Expect(object.GetLabels()).NotTo(HaveKey("release.giantswarm.io/version"))
+					Expect(object.GetAnnotations()).NotTo(HaveKey("release.giantswarm.io/notes"))
+				}
+			})
+		})
+	})
+
+	Describe("endpoint overrides", func() {
+		getEndpoint := func() map[string]interface{} {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			endpoint, _, err := unstructured.NestedMap(providerConfig.Object, "spec", "endpoint")
+			Expect(err).NotTo(HaveOccurred())
+			return endpoint
+		}
+
+		BeforeEach(func() {
+			var err error
+			reconciler.Endpoint, err = controllers.ParseEndpointConfig(`
+url: http://localstack.localstack.svc:4566
+services: [sts, s3]
+hostnameImmutable: true
+signingRegion: us-east-1
+`)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("renders the endpoint into the provider config", func() {
+			Expect(getEndpoint()).To(MatchAllKeys(Keys{
+				"source": Equal("Custom"),
+				"url": MatchAllKeys(Keys{
+					"type":   Equal("Static"),
+					"static": Equal("http://localstack.localstack.svc:4566"),
+				}),
+				"services":          ConsistOf("sts", "s3"),
+				"hostnameImmutable": BeTrue(),
+				"signingRegion":     Equal("us-east-1"),
+			}))
+		})
+
+		When("the cluster overrides the endpoint", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.EndpointAnnotation: `{"url": "https://vpce-1234.example.com"}`,
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("uses the endpoint of the cluster", func() {
+				Expect(getEndpoint()).To(MatchAllKeys(Keys{
+					"source": Equal("Custom"),
+					"url": MatchAllKeys(Keys{
+						"type":   Equal("Static"),
+						"static": Equal("https://vpce-1234.example.com"),
+					}),
+				}))
+			})
+		})
+
+		When("the cluster disables the endpoint", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.EndpointAnnotation: "{}",
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("renders no endpoint", func() {
+				Expect(getEndpoint()).To(BeEmpty())
+			})
+		})
+
+		When("the cluster has an invalid endpoint", func() {
+			BeforeEach(func() {
+				patchedCluster := cluster.DeepCopy()
+				patchedCluster.Annotations = map[string]string{
+					controllers.EndpointAnnotation: `{"url": "not-a-url"}`,
+				}
+				err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("rejects the annotation", func() {
+				err := k8sClient.Get(ctx, types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, cluster)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidAnnotationReason))
+			})
+		})
+	})
+
+	Describe("shared provider configs", func() {
+		getSharedProviderConfig := func() (*unstructured.Unstructured, error) {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: "account-" + accountID}, providerConfig)
+			return providerConfig, err
+		}
+
+		deleteCluster := func(cluster *capi.Cluster) {
+			patchedCluster := cluster.DeepCopy()
+			patchedCluster.Finalizers = []string{controllers.Finalizer}
+			err := k8sClient.Patch(ctx, patchedCluster, client.MergeFrom(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Delete(ctx, cluster)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		When("they are created alongside the cluster provider configs", func() {
+			BeforeEach(func() {
+				reconciler.SharedProviderConfig = controllers.SharedProviderConfigAlongside
+			})
+
+			It("creates the shared provider config of the account", func() {
+				providerConfig, err := getSharedProviderConfig()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(providerConfig.GetLabels()).To(HaveKeyWithValue(controllers.AccountIDLabel, accountID))
+				Expect(providerConfig.GetLabels()).NotTo(HaveKey(controllers.ClusterNameLabel))
+				Expect(providerConfig.GetAnnotations()).To(HaveKeyWithValue(controllers.ReferencedByAnnotation, cluster.Namespace+"/"+cluster.Name))
+
+				roleARN, _, err := unstructured.NestedString(providerConfig.Object, "spec", "credentials", "webIdentity", "roleARN")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(roleARN).To(Equal(fmt.Sprintf("arn:aws:iam::%s:role/the-provider-role", accountID)))
+
+				verifyProviderConfig()
+			})
+
+			It("adds the shared name to the configmap", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configMap.Data).To(HaveKeyWithValue("values", ContainSubstring(fmt.Sprintf("sharedName: account-%s", accountID))))
+			})
+
+			When("another cluster uses the same account", func() {
+				var otherCluster *capi.Cluster
+
+				JustBeforeEach(func() {
+					_, _, otherCluster = createRandomCapaClusterWithIdentity(controllers.AccountIDAnnotation, accountID)
+					_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(otherCluster)})
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					err := k8sClient.Delete(ctx, otherCluster)
+					if !k8serrors.IsNotFound(err) {
+						Expect(err).NotTo(HaveOccurred())
+					}
+				})
+
+				It("references both clusters", func() {
+					providerConfig, err := getSharedProviderConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(strings.Split(providerConfig.GetAnnotations()[controllers.ReferencedByAnnotation], ",")).To(ConsistOf(
+						cluster.Namespace+"/"+cluster.Name,
+						otherCluster.Namespace+"/"+otherCluster.Name,
+					))
+				})
+
+				It("keeps the shared provider config until the last cluster is deleted", func() {
+					deleteCluster(cluster)
+
+					providerConfig, err := getSharedProviderConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(providerConfig.GetAnnotations()).To(HaveKeyWithValue(controllers.ReferencedByAnnotation, otherCluster.Namespace+"/"+otherCluster.Name))
+
+					deleteCluster(otherCluster)
+
+					_, err = getSharedProviderConfig()
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+
+			When("shared provider configs are disabled again", func() {
+				JustBeforeEach(func() {
+					reconciler.SharedProviderConfig = controllers.SharedProviderConfigDisabled
+					_, err := reconciler.Reconcile(ctx, request)
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				It("deletes the shared provider config", func() {
+					_, err := getSharedProviderConfig()
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+		})
+
+		When("they are created instead of the cluster provider configs", func() {
+			BeforeEach(func() {
+				reconciler.SharedProviderConfig = controllers.SharedProviderConfigInstead
+			})
+
+			It("only creates the shared provider config", func() {
+				_, err := getSharedProviderConfig()
+				Expect(err).NotTo(HaveOccurred())
+
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				err = k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("uses the shared provider config name in the configmap", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(configMap.Data).To(HaveKeyWithValue("values", ContainSubstring(fmt.Sprintf("name: account-%s", accountID))))
+			})
+
+			When("the cluster is deleted", func() {
+				JustBeforeEach(func() {
+					deleteCluster(cluster)
+				})
+
+				It("deletes the shared provider config", func() {
+					_, err := getSharedProviderConfig()
+					Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+				})
+			})
+		})
+	})
+
+	When("the cluster is deleted", func() {
+		BeforeEach(func() {
+			patchedCluster := cluster.DeepCopy()
+			patchedCluster.Finalizers = []string{controllers.Finalizer}
+
+			err := k8sClient.Patch(context.Background(), patchedCluster, client.MergeFrom(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Delete(context.Background(), cluster)
+			Expect(err).NotTo(HaveOccurred())
+
+			patchedCapaCluster := awsCluster.DeepCopy()
+			patchedCapaCluster.Finalizers = []string{controllers.Finalizer}
+
+			err = k8sClient.Patch(context.Background(), patchedCapaCluster, client.MergeFrom(awsCluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Delete(context.Background(), awsCluster)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("removes the finalizer on Cluster", func() {
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			}, cluster)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("removes the finalizer on AWSCluster", func() {
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			}, awsCluster)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("removes the config map", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("removes the providerconfig", func() {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			}, providerConfig)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		// Releases before the cluster labels created the config map with
+		// only the managed-by label and the provider config without labels.
+		// An unlabelled provider config can not be told from a hand-written
+		// one and is kept.
+		When("it still has the objects of a previous release", func() {
+			BeforeEach(func() {
+				Expect(k8sClient.Create(ctx, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: cluster.Namespace,
+						Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+						Labels: map[string]string{
+							controllers.ManagedByLabel: controllers.ManagedByValue,
+						},
+					},
+				})).To(Succeed())
+
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.Object = map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"name": cluster.Name,
+					},
+					"spec": map[string]interface{}{
+						"credentials": map[string]interface{}{
+							"source": "WebIdentity",
+							"webIdentity": map[string]interface{}{
+								"roleARN": fmt.Sprintf("arn:aws:iam::%s:role/the-provider-role", accountID),
+							},
+						},
+					},
+				}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+				Expect(k8sClient.Create(ctx, providerConfig)).To(Succeed())
+			})
+
+			It("removes the config map", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("keeps the unlabelled providerconfig", func() {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+					Group:   "aws.upbound.io",
+					Kind:    "ProviderConfig",
+					Version: "v1beta1",
+				})
+
+				err := k8sClient.Get(ctx, types.NamespacedName{Name: cluster.Name}, providerConfig)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		When("an object of someone else has the name of the config map", func() {
+			BeforeEach(func() {
+				Expect(k8sClient.Create(ctx, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: cluster.Namespace,
+						Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+					},
+				})).To(Succeed())
+			})
+
+			It("keeps it", func() {
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: cluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+				}, configMap)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	When("the cluster is in china", func() {
+		BeforeEach(func() {
+			awsCluster.Spec.Region = "cn-north-1"
+			err := k8sClient.Update(ctx, awsCluster)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates the configmap with the correct aws partition", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue("values", MatchYAML(fmt.Sprintf(`
+                accountID: "%s"
+                awsCluster:
+                  securityGroups: {}
+                  vpcId: vpc-1
+                baseDomain: %s.base.domain.io
+                oidcDomain: irsa.%s.base.domain.io
+                oidcDomains:
+                - irsa.%s.base.domain.io
+                clusterName: %s
+                region: cn-north-1
+                awsPartition: aws-cn
+                ready: false
+                missing:
+                - awsCluster.securityGroups.controlPlane
+                - awsCluster.securityGroups.node
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws-cn:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name, cluster.Name, accountID))))
+		})
+
+		It("creates the provider config with the correct aws partition", func() {
+			providerConfig := &unstructured.Unstructured{}
+			providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
+				Group:   "aws.upbound.io",
+				Kind:    "ProviderConfig",
+				Version: "v1beta1",
+			})
+
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			}, providerConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(providerConfig.Object).To(HaveKeyWithValue("metadata", MatchKeys(IgnoreExtras, Keys{
+				"name": Equal(cluster.Name),
+			})))
+			Expect(providerConfig.Object).To(HaveKeyWithValue("spec", MatchKeys(IgnoreExtras, Keys{
+				"credentials": MatchKeys(IgnoreExtras, Keys{
+					"source": Equal("WebIdentity"),
+					"webIdentity": MatchKeys(IgnoreExtras, Keys{
+						"roleARN": Equal(fmt.Sprintf("arn:aws-cn:iam::%s:role/the-provider-role", accountID)),
+					}),
+				}),
+			})))
+		})
+	})
+
+	When("the cluster is provisioned by CAPA", func() {
+		BeforeEach(func() {
+			awsCluster.Spec.NetworkSpec.VPC.ID = "vpc-123456"
+			err := k8sClient.Update(ctx, awsCluster)
+			Expect(err).NotTo(HaveOccurred())
+
+			awsCluster.Status.Network.SecurityGroups = map[capa.SecurityGroupRole]capa.SecurityGroup{
+				capa.SecurityGroupControlPlane: {
+					ID: "sg-789987",
+				},
+				capa.SecurityGroupNode: {
+					ID: "sg-898989",
+				},
+			}
+			err = k8sClient.Status().Update(ctx, awsCluster)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates the configmap with the correct VPC ID and security group ID(s)", func() {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data).To(HaveKeyWithValue("values", MatchYAML(fmt.Sprintf(`
+                accountID: "%s"
+                awsCluster:
+                  securityGroups:
+                    controlPlane:
+                      id: sg-789987
+                    node:
+                      id: sg-898989
+                  vpcId: vpc-123456
+                awsPartition: aws
+                baseDomain: %s.base.domain.io
+                oidcDomain: irsa.%s.base.domain.io
+                oidcDomains:
+                - irsa.%s.base.domain.io
+                clusterName: %s
+                region: the-region
+                ready: true
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, cluster.Name, cluster.Name, accountID))))
+		})
+	})
+
+	When("the cluster has multiple service account issuers defined by an annotation", func() {
 		BeforeEach(func() {
 			awsCluster.Spec.NetworkSpec.VPC.ID = "vpc-123456"
 			if awsCluster.Annotations == nil {
@@ -388,7 +2104,134 @@ var _ = Describe("ConfigMapReconcilerCAPA", func() {
                 - second
                 clusterName: %s
                 region: the-region
-            `, accountID, cluster.Name, cluster.Name))))
+                ready: false
+                missing:
+                - awsCluster.securityGroups.controlPlane
+                - awsCluster.securityGroups.node
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, accountID))))
+		})
+	})
+
+	Describe("infrastructure readiness", func() {
+		getValues := func() map[string]interface{} {
+			configMap := &corev1.ConfigMap{}
+			err := k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+			}, configMap)
+			Expect(err).NotTo(HaveOccurred())
+
+			values := map[string]interface{}{}
+			Expect(yaml.Unmarshal([]byte(configMap.Data[controllers.ValuesKey]), &values)).To(Succeed())
+			return values
+		}
+
+		getCondition := func() *capi.Condition {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)
+			Expect(err).NotTo(HaveOccurred())
+			return conditions.Get(cluster, controllers.InfrastructureReadyCondition)
+		}
+
+		It("writes the partial values and requeues", func() {
+			result, err := reconciler.Reconcile(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			Expect(getValues()).To(HaveKeyWithValue("ready", false))
+			Expect(getValues()).To(HaveKeyWithValue("missing", ConsistOf(
+				controllers.ControlPlaneSecurityGroupField,
+				controllers.NodeSecurityGroupField,
+			)))
+
+			condition := getCondition()
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(controllers.WaitingForInfrastructureReason))
+			Expect(condition.Message).To(ContainSubstring(controllers.NodeSecurityGroupField))
+		})
+
+		When("the infrastructure becomes ready", func() {
+			JustBeforeEach(func() {
+				tests.PatchAWSClusterStatus(k8sClient, awsCluster, capa.AWSClusterStatus{
+					Ready: true,
+					Network: capa.NetworkStatus{
+						SecurityGroups: map[capa.SecurityGroupRole]capa.SecurityGroup{
+							capa.SecurityGroupControlPlane: {ID: "sg-1"},
+							capa.SecurityGroupNode:         {ID: "sg-2"},
+						},
+					},
+				})
+			})
+
+			It("marks the values as ready and stops requeueing", func() {
+				result, err := reconciler.Reconcile(ctx, request)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(BeZero())
+
+				Expect(getValues()).To(HaveKeyWithValue("ready", true))
+				Expect(getValues()).NotTo(HaveKey("missing"))
+
+				condition := getCondition()
+				Expect(condition).NotTo(BeNil())
+				Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+			})
+		})
+	})
+
+	Describe("non-AWS clusters", func() {
+		var otherCluster *capi.Cluster
+
+		BeforeEach(func() {
+			otherCluster = newCapiCluster(tests.GenerateGUID("azure"))
+			otherCluster.Spec.InfrastructureRef = &corev1.ObjectReference{
+				Kind: "AzureCluster",
+			}
+		})
+
+		JustBeforeEach(func() {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{
+				NamespacedName: client.ObjectKeyFromObject(otherCluster),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(otherCluster), otherCluster)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, otherCluster)).To(Succeed())
+		})
+
+		When("the cluster is not managed", func() {
+			BeforeEach(func() {
+				Expect(k8sClient.Create(ctx, otherCluster)).To(Succeed())
+			})
+
+			It("skips the cluster without adding the finalizer", func() {
+				Expect(otherCluster.Finalizers).NotTo(ContainElement(controllers.Finalizer))
+
+				configMap := &corev1.ConfigMap{}
+				err := k8sClient.Get(ctx, types.NamespacedName{
+					Namespace: otherCluster.Namespace,
+					Name:      fmt.Sprintf("%s-crossplane-config", otherCluster.Name),
+				}, configMap)
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+
+		When("the cluster still has the finalizer", func() {
+			BeforeEach(func() {
+				otherCluster.Finalizers = []string{controllers.Finalizer}
+				Expect(k8sClient.Create(ctx, otherCluster)).To(Succeed())
+			})
+
+			It("removes the finalizer", func() {
+				Expect(otherCluster.Finalizers).NotTo(ContainElement(controllers.Finalizer))
+			})
 		})
 	})
 
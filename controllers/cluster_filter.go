@@ -0,0 +1,55 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"slices"
+
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// awsInfrastructureKinds are the infrastructure kinds of the CAPA, EKS and
+// ROSA clusters managed by the operator.
+var awsInfrastructureKinds = []string{"AWSCluster", "AWSManagedCluster", "ROSACluster"}
+
+// IsAWSCluster returns whether the infrastructure of the cluster is provided
+// by CAPA. Clusters of other providers, e.g. CAPZ, CAPV or vcluster, are
+// ignored by the operator.
+func IsAWSCluster(cluster *capi.Cluster) bool {
+	return cluster.Spec.InfrastructureRef != nil &&
+		slices.Contains(awsInfrastructureKinds, cluster.Spec.InfrastructureRef.Kind)
+}
+
+// isManagedCluster returns whether the operator reconciles the cluster. Other
+// clusters still carrying the finalizer, e.g. from an older release, are
+// reconciled once more to clean up and remove it.
+func isManagedCluster(cluster *capi.Cluster) bool {
+	return IsAWSCluster(cluster) || controllerutil.ContainsFinalizer(cluster, Finalizer)
+}
+
+// managedClusterPredicate filters out events of clusters the operator does
+// not manage or that are outside the scope of this instance, so they are never
+// enqueued.
+func managedClusterPredicate(scope ClusterScope) predicate.Funcs {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		cluster, ok := obj.(*capi.Cluster)
+		return ok && scope.Contains(cluster) && isManagedCluster(cluster)
+	})
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterInfoResolver reads the AWS details of a cluster from its control
+// plane or infrastructure objects. The ProviderConfig settings of the
+// returned ClusterInfo are filled in by the reconciler afterwards.
+type ClusterInfoResolver interface {
+	Resolve(ctx context.Context, cluster *capi.Cluster) (*ClusterInfo, error)
+}
+
+// ClusterInfoResolverSelector matches clusters by the kinds of their control
+// plane and infrastructure refs. An empty kind matches any cluster, including
+// clusters without that ref.
+type ClusterInfoResolverSelector struct {
+	ControlPlaneKind   string
+	InfrastructureKind string
+}
+
+func (s ClusterInfoResolverSelector) Matches(cluster *capi.Cluster) bool {
+	if s.ControlPlaneKind != "" &&
+		(cluster.Spec.ControlPlaneRef == nil || cluster.Spec.ControlPlaneRef.Kind != s.ControlPlaneKind) {
+		return false
+	}
+	if s.InfrastructureKind != "" &&
+		(cluster.Spec.InfrastructureRef == nil || cluster.Spec.InfrastructureRef.Kind != s.InfrastructureKind) {
+		return false
+	}
+	return true
+}
+
+type registeredClusterInfoResolver struct {
+	selector ClusterInfoResolverSelector
+	resolver ClusterInfoResolver
+}
+
+// ClusterInfoResolvers selects the resolver of a cluster. Resolvers are
+// tried in registration order, so more specific selectors have to be
+// registered first.
+type ClusterInfoResolvers struct {
+	resolvers []registeredClusterInfoResolver
+}
+
+func (r *ClusterInfoResolvers) Register(selector ClusterInfoResolverSelector, resolver ClusterInfoResolver) {
+	r.resolvers = append(r.resolvers, registeredClusterInfoResolver{
+		selector: selector,
+		resolver: resolver,
+	})
+}
+
+// Get returns the first resolver matching the cluster or nil when none does.
+func (r *ClusterInfoResolvers) Get(cluster *capi.Cluster) ClusterInfoResolver {
+	for _, registered := range r.resolvers {
+		if registered.selector.Matches(cluster) {
+			return registered.resolver
+		}
+	}
+	return nil
+}
+
+// DefaultClusterInfoResolvers returns the EKS and ROSA resolvers for clusters
+// with an AWSManagedControlPlane or a ROSAControlPlane and the CAPA resolver
+// for other clusters with an AWSCluster. Other clusters have no resolver.
+func DefaultClusterInfoResolvers(c client.Client, baseDomain string) *ClusterInfoResolvers {
+	resolvers := &ClusterInfoResolvers{}
+	resolvers.Register(
+		ClusterInfoResolverSelector{ControlPlaneKind: "AWSManagedControlPlane"},
+		&EKSClusterInfoResolver{Client: c},
+	)
+	resolvers.Register(
+		ClusterInfoResolverSelector{ControlPlaneKind: "ROSAControlPlane"},
+		&ROSAClusterInfoResolver{Client: c},
+	)
+	resolvers.Register(
+		ClusterInfoResolverSelector{InfrastructureKind: "AWSCluster"},
+		&CAPAClusterInfoResolver{Client: c, BaseDomain: baseDomain},
+	)
+
+	return resolvers
+}
+
+func IsEKS(cluster capi.Cluster) bool {
+	return ClusterInfoResolverSelector{ControlPlaneKind: "AWSManagedControlPlane"}.Matches(&cluster)
+}
+
+// getIdentityRoleARN returns the role of the AWSClusterRoleIdentity the
+// cluster objects refer to.
+func getIdentityRoleARN(ctx context.Context, c client.Client, identityRef *capa.AWSIdentityReference, namespace string) (arn.ARN, error) {
+	if identityRef == nil {
+		return arn.ARN{}, errors.New("cluster has no identity ref")
+	}
+
+	identity := &capa.AWSClusterRoleIdentity{}
+	err := c.Get(
+		ctx,
+		types.NamespacedName{
+			Name:      identityRef.Name,
+			Namespace: namespace,
+		},
+		identity,
+	)
+	if err != nil {
+		return arn.ARN{}, errors.WithStack(err)
+	}
+
+	roleARN, err := arn.Parse(identity.Spec.RoleArn)
+	if err != nil {
+		return arn.ARN{}, errors.Wrap(err, "failed to parse role arn")
+	}
+
+	return roleARN, nil
+}
+
+// getPartition returns the partition of a region, one of awsPartitions.
+func getPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
+
+// getDNSSuffix returns the DNS suffix of the partition of a region. GovCloud
+// uses the same suffix as the commercial partition.
+func getDNSSuffix(region string) string {
+	if getPartition(region) == "aws-cn" {
+		return "amazonaws.com.cn"
+	}
+	return "amazonaws.com"
+}
+
+// getEKSOIDCDomain returns the issuer domain of the service accounts of an
+// EKS cluster.
+func getEKSOIDCDomain(region, eksID string) string {
+	return "oidc.eks." + region + "." + getDNSSuffix(region) + "/id/" + eksID
+}
+
+func getEKSId(urlString string) (string, error) {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return "", err
+	}
+
+	// The host part of the URL is in the form of "ED3AA07D016EA49EEBC31AB274E7F3DD.sk1.eu-west-2.eks.amazonaws.com"
+	// We can split it by '.' and take the first part
+	parts := strings.Split(u.Hostname(), ".")
+	if len(parts) > 0 {
+		return parts[0], nil
+	}
+
+	return "", fmt.Errorf("unable to extract ID from URL")
+}
+
+func getIRSATrustDomains(awsCluster *capa.AWSCluster, fallbackComputedDomain string) []string {
+	annotations := awsCluster.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if s := annotations["aws.giantswarm.io/irsa-trust-domains"]; s != "" {
+		irsaTrustDomains := []string{}
+		values := strings.Split(s, ",")
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			if value != "" && !slices.Contains(irsaTrustDomains, value) {
+				irsaTrustDomains = append(irsaTrustDomains, value)
+			}
+		}
+		if len(irsaTrustDomains) > 0 {
+			return irsaTrustDomains
+		}
+	}
+	return []string{fallbackComputedDomain}
+}
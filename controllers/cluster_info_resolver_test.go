@@ -0,0 +1,431 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+func newFakeClient(objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(capi.AddToScheme(scheme)).To(Succeed())
+	Expect(capa.AddToScheme(scheme)).To(Succeed())
+	Expect(eks.AddToScheme(scheme)).To(Succeed())
+	Expect(rosa.AddToScheme(scheme)).To(Succeed())
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newFakeRoleIdentity(roleARN string) *capa.AWSClusterRoleIdentity {
+	return &capa.AWSClusterRoleIdentity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "the-identity",
+			Namespace: "org-test",
+		},
+		Spec: capa.AWSClusterRoleIdentitySpec{
+			AWSRoleSpec: capa.AWSRoleSpec{
+				RoleArn: roleARN,
+			},
+		},
+	}
+}
+
+var _ = Describe("ClusterInfoResolvers", Label(unitLabel), func() {
+	var (
+		resolvers *controllers.ClusterInfoResolvers
+		cluster   *capi.Cluster
+	)
+
+	BeforeEach(func() {
+		resolvers = controllers.DefaultClusterInfoResolvers(newFakeClient(), "base.domain.io")
+		cluster = &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "org-test",
+			},
+		}
+	})
+
+	It("selects the CAPA resolver for AWSCluster clusters", func() {
+		cluster.Spec.InfrastructureRef = &corev1.ObjectReference{Kind: "AWSCluster"}
+		Expect(resolvers.Get(cluster)).To(BeAssignableToTypeOf(&controllers.CAPAClusterInfoResolver{}))
+	})
+
+	It("selects no resolver for other clusters", func() {
+		Expect(resolvers.Get(cluster)).To(BeNil())
+
+		cluster.Spec.InfrastructureRef = &corev1.ObjectReference{Kind: "AWSManagedCluster"}
+		Expect(resolvers.Get(cluster)).To(BeNil())
+
+		cluster.Spec.ControlPlaneRef = &corev1.ObjectReference{Kind: "KubeadmControlPlane"}
+		Expect(resolvers.Get(cluster)).To(BeNil())
+	})
+
+	It("selects the EKS resolver for AWSManagedControlPlane clusters", func() {
+		cluster.Spec.ControlPlaneRef = &corev1.ObjectReference{Kind: "AWSManagedControlPlane"}
+		Expect(resolvers.Get(cluster)).To(BeAssignableToTypeOf(&controllers.EKSClusterInfoResolver{}))
+	})
+
+	It("selects the ROSA resolver for ROSAControlPlane clusters", func() {
+		cluster.Spec.ControlPlaneRef = &corev1.ObjectReference{Kind: "ROSAControlPlane"}
+		Expect(resolvers.Get(cluster)).To(BeAssignableToTypeOf(&controllers.ROSAClusterInfoResolver{}))
+	})
+
+	It("matches control plane and infrastructure kinds", func() {
+		selector := controllers.ClusterInfoResolverSelector{
+			ControlPlaneKind:   "KubeadmControlPlane",
+			InfrastructureKind: "AWSCluster",
+		}
+		Expect(selector.Matches(cluster)).To(BeFalse())
+
+		cluster.Spec.ControlPlaneRef = &corev1.ObjectReference{Kind: "KubeadmControlPlane"}
+		Expect(selector.Matches(cluster)).To(BeFalse())
+
+		cluster.Spec.InfrastructureRef = &corev1.ObjectReference{Kind: "AWSCluster"}
+		Expect(selector.Matches(cluster)).To(BeTrue())
+	})
+
+	It("returns nil when no resolver matches", func() {
+		resolvers = &controllers.ClusterInfoResolvers{}
+		resolvers.Register(
+			controllers.ClusterInfoResolverSelector{InfrastructureKind: "AWSCluster"},
+			&controllers.CAPAClusterInfoResolver{},
+		)
+		Expect(resolvers.Get(cluster)).To(BeNil())
+	})
+})
+
+var _ = Describe("CAPAClusterInfoResolver", Label(unitLabel), func() {
+	var (
+		ctx        context.Context
+		awsCluster *capa.AWSCluster
+		cluster    *capi.Cluster
+		identity   *capa.AWSClusterRoleIdentity
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		identity = newFakeRoleIdentity("arn:aws:iam::123456789012:role/the-role")
+		cluster = &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "org-test",
+			},
+		}
+		awsCluster = &capa.AWSCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "org-test",
+			},
+			Spec: capa.AWSClusterSpec{
+				Region: "cn-north-1",
+				NetworkSpec: capa.NetworkSpec{
+					VPC: capa.VPCSpec{ID: "vpc-1"},
+				},
+				IdentityRef: &capa.AWSIdentityReference{
+					Name: identity.Name,
+					Kind: "AWSClusterRoleIdentity",
+				},
+			},
+			Status: capa.AWSClusterStatus{
+				Network: capa.NetworkStatus{
+					SecurityGroups: map[capa.SecurityGroupRole]capa.SecurityGroup{
+						capa.SecurityGroupNode: {ID: "sg-node"},
+					},
+				},
+			},
+		}
+	})
+
+	It("resolves the cluster info from the AWSCluster", func() {
+		resolver := &controllers.CAPAClusterInfoResolver{
+			Client:     newFakeClient(awsCluster, identity),
+			BaseDomain: "base.domain.io",
+		}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.Name).To(Equal("test"))
+		Expect(clusterInfo.Namespace).To(Equal("org-test"))
+		Expect(clusterInfo.Region).To(Equal("cn-north-1"))
+		Expect(clusterInfo.AWSPartition).To(Equal("aws-cn"))
+		Expect(clusterInfo.VpcID).To(Equal("vpc-1"))
+		Expect(clusterInfo.RoleArn.AccountID).To(Equal("123456789012"))
+		Expect(clusterInfo.OIDCDomain).To(Equal("irsa.test.base.domain.io"))
+		Expect(clusterInfo.OIDCDomains).To(Equal([]string{"irsa.test.base.domain.io"}))
+		Expect(clusterInfo.SecurityGroups.ControlPlane).To(BeNil())
+		Expect(clusterInfo.SecurityGroups.Node.ID).To(Equal("sg-node"))
+		Expect(clusterInfo.AWSCluster).NotTo(BeNil())
+		Expect(clusterInfo.AWSManagedControlPlane).To(BeNil())
+		Expect(clusterInfo.Missing).To(Equal([]string{controllers.ControlPlaneSecurityGroupField}))
+	})
+
+	It("reports all required values that are not known yet", func() {
+		awsCluster.Spec.NetworkSpec.VPC.ID = ""
+		awsCluster.Status = capa.AWSClusterStatus{}
+		resolver := &controllers.CAPAClusterInfoResolver{Client: newFakeClient(awsCluster, identity)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.Missing).To(Equal([]string{
+			controllers.ControlPlaneSecurityGroupField,
+			controllers.NodeSecurityGroupField,
+			controllers.VpcIDField,
+		}))
+	})
+
+	It("prefers the IRSA trust domains annotation", func() {
+		awsCluster.Annotations = map[string]string{
+			"aws.giantswarm.io/irsa-trust-domains": "irsa.example.com, irsa.other.com",
+		}
+		resolver := &controllers.CAPAClusterInfoResolver{
+			Client:     newFakeClient(awsCluster, identity),
+			BaseDomain: "base.domain.io",
+		}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.OIDCDomain).To(Equal("irsa.example.com"))
+		Expect(clusterInfo.OIDCDomains).To(Equal([]string{"irsa.example.com", "irsa.other.com"}))
+	})
+
+	It("returns a not found error when the AWSCluster is missing", func() {
+		resolver := &controllers.CAPAClusterInfoResolver{Client: newFakeClient(identity)}
+
+		_, err := resolver.Resolve(ctx, cluster)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("fails without identity ref", func() {
+		awsCluster.Spec.IdentityRef = nil
+		resolver := &controllers.CAPAClusterInfoResolver{Client: newFakeClient(awsCluster)}
+
+		_, err := resolver.Resolve(ctx, cluster)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("EKSClusterInfoResolver", Label(unitLabel), func() {
+	var (
+		ctx          context.Context
+		controlPlane *eks.AWSManagedControlPlane
+		cluster      *capi.Cluster
+		identity     *capa.AWSClusterRoleIdentity
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		identity = newFakeRoleIdentity("arn:aws:iam::123456789012:role/the-role")
+		cluster = &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "org-test",
+			},
+			Spec: capi.ClusterSpec{
+				ControlPlaneRef: &corev1.ObjectReference{Kind: "AWSManagedControlPlane"},
+			},
+		}
+		controlPlane = &eks.AWSManagedControlPlane{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "org-test",
+			},
+			Spec: eks.AWSManagedControlPlaneSpec{
+				Region: "eu-west-2",
+				ControlPlaneEndpoint: capi.APIEndpoint{
+					Host: "https://eks123clusterID.sk1.eu-west-2.eks.amazonaws.com",
+					Port: 443,
+				},
+				NetworkSpec: capa.NetworkSpec{
+					VPC: capa.VPCSpec{ID: "vpc-1"},
+				},
+				IdentityRef: &capa.AWSIdentityReference{
+					Name: identity.Name,
+					Kind: "AWSClusterRoleIdentity",
+				},
+			},
+		}
+	})
+
+	It("resolves the cluster info from the AWSManagedControlPlane", func() {
+		resolver := &controllers.EKSClusterInfoResolver{Client: newFakeClient(controlPlane, identity)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.Name).To(Equal("test"))
+		Expect(clusterInfo.Region).To(Equal("eu-west-2"))
+		Expect(clusterInfo.AWSPartition).To(Equal("aws"))
+		Expect(clusterInfo.VpcID).To(Equal("vpc-1"))
+		Expect(clusterInfo.RoleArn.AccountID).To(Equal("123456789012"))
+		Expect(clusterInfo.OIDCDomain).To(Equal("oidc.eks.eu-west-2.amazonaws.com/id/eks123clusterID"))
+		Expect(clusterInfo.OIDCDomains).To(Equal([]string{clusterInfo.OIDCDomain}))
+		Expect(clusterInfo.SecurityGroups).To(BeNil())
+		Expect(clusterInfo.AWSManagedControlPlane).NotTo(BeNil())
+		Expect(clusterInfo.AWSCluster).To(BeNil())
+		Expect(clusterInfo.Missing).To(BeEmpty())
+	})
+
+	It("reports the OIDC domain as missing until the endpoint is known", func() {
+		controlPlane.Spec.ControlPlaneEndpoint = capi.APIEndpoint{}
+		resolver := &controllers.EKSClusterInfoResolver{Client: newFakeClient(controlPlane, identity)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.OIDCDomain).To(BeEmpty())
+		Expect(clusterInfo.OIDCDomains).To(BeEmpty())
+		Expect(clusterInfo.Missing).To(Equal([]string{controllers.OIDCDomainField}))
+	})
+
+	It("uses the China DNS suffix for the OIDC domain", func() {
+		controlPlane.Spec.Region = "cn-northwest-1"
+		resolver := &controllers.EKSClusterInfoResolver{Client: newFakeClient(controlPlane, identity)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.AWSPartition).To(Equal("aws-cn"))
+		Expect(clusterInfo.OIDCDomain).To(Equal("oidc.eks.cn-northwest-1.amazonaws.com.cn/id/eks123clusterID"))
+	})
+
+	It("returns a not found error when the identity is missing", func() {
+		resolver := &controllers.EKSClusterInfoResolver{Client: newFakeClient(controlPlane)}
+
+		_, err := resolver.Resolve(ctx, cluster)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ROSAClusterInfoResolver", Label(unitLabel), func() {
+	var (
+		ctx          context.Context
+		controlPlane *rosa.ROSAControlPlane
+		cluster      *capi.Cluster
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		cluster = &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "org-test",
+			},
+			Spec: capi.ClusterSpec{
+				ControlPlaneRef: &corev1.ObjectReference{
+					Kind: "ROSAControlPlane",
+					Name: "test-control-plane",
+				},
+				InfrastructureRef: &corev1.ObjectReference{
+					Kind: "ROSACluster",
+					Name: "test",
+				},
+			},
+		}
+		controlPlane = &rosa.ROSAControlPlane{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-control-plane",
+				Namespace: "org-test",
+			},
+			Spec: rosa.RosaControlPlaneSpec{
+				RosaClusterName:  "test",
+				Region:           "us-east-1",
+				Subnets:          []string{"subnet-1", "subnet-2"},
+				OIDCID:           "the-oidc-id",
+				InstallerRoleARN: "arn:aws:iam::123456789012:role/ManagedOpenShift-HCP-ROSA-Installer-Role",
+			},
+		}
+	})
+
+	It("resolves the cluster info from the ROSAControlPlane", func() {
+		resolver := &controllers.ROSAClusterInfoResolver{Client: newFakeClient(controlPlane)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.Name).To(Equal("test"))
+		Expect(clusterInfo.Namespace).To(Equal("org-test"))
+		Expect(clusterInfo.Region).To(Equal("us-east-1"))
+		Expect(clusterInfo.AWSPartition).To(Equal("aws"))
+		Expect(clusterInfo.VpcID).To(BeEmpty())
+		Expect(clusterInfo.Subnets).To(Equal([]string{"subnet-1", "subnet-2"}))
+		Expect(clusterInfo.RoleArn.AccountID).To(Equal("123456789012"))
+		Expect(clusterInfo.OIDCDomain).To(Equal("oidc.op1.openshiftapps.com/the-oidc-id"))
+		Expect(clusterInfo.OIDCDomains).To(Equal([]string{clusterInfo.OIDCDomain}))
+		Expect(clusterInfo.ROSAControlPlane).NotTo(BeNil())
+		Expect(clusterInfo.Missing).To(BeEmpty())
+	})
+
+	It("prefers the OIDC endpoint of the control plane status", func() {
+		controlPlane.Status.OIDCEndpointURL = "https://oidc.example.com/the-oidc-id"
+		resolver := &controllers.ROSAClusterInfoResolver{Client: newFakeClient(controlPlane)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.OIDCDomain).To(Equal("oidc.example.com/the-oidc-id"))
+	})
+
+	It("uses the role of an AWSClusterRoleIdentity", func() {
+		identity := newFakeRoleIdentity("arn:aws:iam::210987654321:role/the-role")
+		controlPlane.Spec.IdentityRef = &capa.AWSIdentityReference{
+			Name: identity.Name,
+			Kind: "AWSClusterRoleIdentity",
+		}
+		resolver := &controllers.ROSAClusterInfoResolver{Client: newFakeClient(controlPlane, identity)}
+
+		clusterInfo, err := resolver.Resolve(ctx, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clusterInfo.RoleArn.AccountID).To(Equal("210987654321"))
+	})
+
+	It("returns a not found error when the control plane is missing", func() {
+		resolver := &controllers.ROSAClusterInfoResolver{Client: newFakeClient()}
+
+		_, err := resolver.Resolve(ctx, cluster)
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("IsAWSCluster", Label(unitLabel), func() {
+	DescribeTable("checks the infrastructure kind",
+		func(infrastructureRef *corev1.ObjectReference, expected bool) {
+			cluster := &capi.Cluster{
+				Spec: capi.ClusterSpec{
+					InfrastructureRef: infrastructureRef,
+				},
+			}
+			Expect(controllers.IsAWSCluster(cluster)).To(Equal(expected))
+		},
+		Entry("CAPA", &corev1.ObjectReference{Kind: "AWSCluster"}, true),
+		Entry("EKS", &corev1.ObjectReference{Kind: "AWSManagedCluster"}, true),
+		Entry("ROSA", &corev1.ObjectReference{Kind: "ROSACluster"}, true),
+		Entry("CAPZ", &corev1.ObjectReference{Kind: "AzureCluster"}, false),
+		Entry("vcluster", &corev1.ObjectReference{Kind: "VCluster"}, false),
+		Entry("no infrastructure ref", nil, false),
+	)
+})
@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/patch"
+)
+
+const (
+	// ConfigMapReadyCondition reports whether the crossplane config map of
+	// the cluster is up to date.
+	ConfigMapReadyCondition capi.ConditionType = "CrossplaneConfigMapReady"
+
+	// ProviderConfigReadyCondition reports whether the crossplane
+	// ProviderConfig of the cluster is up to date.
+	ProviderConfigReadyCondition capi.ConditionType = "CrossplaneProviderConfigReady"
+
+	// SharedProviderConfigReadyCondition reports whether the ProviderConfig
+	// shared by the clusters of the AWS account is up to date. It is only set
+	// when shared ProviderConfigs are enabled.
+	SharedProviderConfigReadyCondition capi.ConditionType = "CrossplaneSharedProviderConfigReady"
+
+	// EnvironmentConfigReadyCondition reports whether the crossplane
+	// EnvironmentConfig of the cluster is up to date.
+	EnvironmentConfigReadyCondition capi.ConditionType = "CrossplaneEnvironmentConfigReady"
+
+	// WorkloadProviderConfigsReadyCondition reports whether the
+	// provider-kubernetes and provider-helm ProviderConfigs pointing at the
+	// workload cluster are up to date.
+	WorkloadProviderConfigsReadyCondition capi.ConditionType = "CrossplaneWorkloadProviderConfigsReady"
+
+	// InfrastructureReadyCondition reports whether all required values of the
+	// cluster are known. The values are written with `ready: false` and the
+	// missing fields until then.
+	InfrastructureReadyCondition capi.ConditionType = "CrossplaneInfrastructureReady"
+
+	// ValuesTemplatesRenderedCondition reports whether all user supplied
+	// values templates rendered for the cluster. It is only set when values
+	// templates are configured.
+	ValuesTemplatesRenderedCondition capi.ConditionType = "CrossplaneValuesTemplatesRendered"
+)
+
+const (
+	// OwnershipConflictReason is used when an object with the name the
+	// operator wants to use already exists and is not managed by the
+	// operator.
+	OwnershipConflictReason = "OwnershipConflict"
+
+	// TemplateRenderFailedReason is used when one or more values templates
+	// failed to render.
+	TemplateRenderFailedReason = "TemplateRenderFailed"
+
+	// ControlPlaneNotInitializedReason is used while objects depending on a
+	// reachable workload cluster API wait for the control plane.
+	ControlPlaneNotInitializedReason = "ControlPlaneNotInitialized"
+
+	// ProviderConfigAPIUnavailableReason is used while no supported
+	// ProviderConfig CRD is installed. The cluster is reconciled again when
+	// one becomes established.
+	ProviderConfigAPIUnavailableReason = "ProviderConfigAPIUnavailable"
+
+	// EnvironmentConfigAPIUnavailableReason is used while the EnvironmentConfig
+	// CRD is not installed. The cluster is reconciled again when it becomes
+	// established.
+	EnvironmentConfigAPIUnavailableReason = "EnvironmentConfigAPIUnavailable"
+
+	// InvalidCredentialsReason is used when the credentials configured for
+	// the cluster ProviderConfig are invalid, e.g. an unknown credentials
+	// source annotation.
+	InvalidCredentialsReason = "InvalidCredentials"
+
+	// WaitingForInfrastructureReason is used while required values, e.g. the
+	// VPC ID or the security groups, are not known yet.
+	WaitingForInfrastructureReason = "WaitingForInfrastructure"
+
+	// InvalidAnnotationReason is used when an override annotation on the
+	// cluster is invalid and the object can not be rendered at all.
+	InvalidAnnotationReason = "InvalidAnnotation"
+)
+
+// ownedConditions lists all conditions written by this operator, so the patch
+// helper can resolve conflicts with other controllers updating the Cluster.
+var ownedConditions = []capi.ConditionType{
+	ConfigMapReadyCondition,
+	ProviderConfigReadyCondition,
+	SharedProviderConfigReadyCondition,
+	EnvironmentConfigReadyCondition,
+	WorkloadProviderConfigsReadyCondition,
+	InfrastructureReadyCondition,
+	ValuesTemplatesRenderedCondition,
+}
+
+// patchConditions writes the conditions set on cluster since the helper was
+// created back to the API server.
+func (r *ConfigMapReconciler) patchConditions(ctx context.Context, helper *patch.Helper, cluster *capi.Cluster) error {
+	err := helper.Patch(ctx, cluster, patch.WithOwnedConditions{Conditions: ownedConditions})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -19,26 +19,36 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"net/url"
-	"slices"
 	"strings"
+	"sync"
+	"text/template"
 
 	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metaerr "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
 	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/yaml"
 )
 
@@ -48,6 +58,72 @@ type ConfigMapReconciler struct {
 	Client       client.Client
 	BaseDomain   string
 	ProviderRole string
+
+	// ProviderConfigKind and ProviderConfigVersion pin the ProviderConfig API.
+	// When empty the API is discovered, see provider_config_api.go.
+	ProviderConfigKind    schema.GroupKind
+	ProviderConfigVersion string
+
+	// Credentials of the generated ProviderConfig, see credentials.go.
+	CredentialsSource    CredentialsSource
+	CredentialsSecret    string
+	CredentialsSecretKey string
+
+	// Additional ProviderConfigs per cluster, see provider_config_variants.go.
+	ProviderConfigVariants []ProviderConfigVariant
+
+	// ProviderConfig shared by the clusters of an account, see
+	// shared_provider_config.go.
+	SharedProviderConfig SharedProviderConfigMode
+
+	// Endpoint override of the generated ProviderConfigs, see endpoint.go.
+	Endpoint *EndpointConfig
+
+	// Clusters reconciled by this instance, see scope.go.
+	Scope ClusterScope
+
+	// APIReader reads clusters the cache no longer holds because they left
+	// the cluster selector, so they are cleaned up. Optional.
+	APIReader client.Reader
+
+	// Resolvers of the AWS details of a cluster, see
+	// cluster_info_resolver.go. Defaults to DefaultClusterInfoResolvers.
+	ClusterInfoResolvers *ClusterInfoResolvers
+
+	// Allow-lists of Cluster labels and annotations copied to the generated
+	// objects, see propagation.go.
+	PropagateLabels      []string
+	PropagateAnnotations []string
+
+	// Templates for the names and namespace of the generated objects. They can
+	// be overridden per cluster with annotations, see naming.go.
+	ConfigMapNameTemplate         string
+	ConfigMapNamespaceTemplate    string
+	ProviderConfigNameTemplate    string
+	EnvironmentConfigNameTemplate string
+
+	// Namespaces besides the one of the cluster the config map namespace
+	// annotation may select, see naming.go.
+	ConfigMapAllowedNamespaces []string
+
+	// Additional config map keys rendered from user supplied templates, see
+	// values_templates.go.
+	ValuesTemplates map[string]*template.Template
+
+	// Renderings of the values in addition to YAML, can be overridden per
+	// cluster, see output_formats.go.
+	OutputFormats []OutputFormat
+
+	// DryRun reports the writes to the generated objects and the cluster
+	// through logs, events on the Recorder and the pending_changes metric
+	// instead of sending them, see dry_run.go.
+	DryRun   bool
+	Recorder record.EventRecorder
+
+	// Guards the settings above against ApplyOperatorConfig while
+	// reconciling, see operator_config.go.
+	settingsLock  sync.RWMutex
+	configChanges chan event.GenericEvent
 }
 
 type ClusterInfo struct {
@@ -58,6 +134,9 @@ type ClusterInfo struct {
 	VpcID        string
 	RoleArn      arn.ARN
 
+	// Only known for ROSA clusters, which have no VPC in their spec.
+	Subnets []string
+
 	// Only contains the primary OIDC domain. See also the plural variant below.
 	OIDCDomain string
 
@@ -65,22 +144,83 @@ type ClusterInfo struct {
 	OIDCDomains []string
 
 	SecurityGroups *crossplaneConfigValuesAWSClusterSecurityGroups
+
+	// Paths of the required values that are not known yet, e.g. while the
+	// infrastructure is created. See readiness.go.
+	Missing []string
+
+	// The object the information was resolved from, depending on the cluster
+	// type only one of them is set.
+	AWSCluster             *capa.AWSCluster
+	AWSManagedControlPlane *eks.AWSManagedControlPlane
+	ROSAControlPlane       *rosa.ROSAControlPlane
+
+	// The effective ProviderConfig settings after applying the cluster
+	// annotations. Credentials is nil when they are invalid.
+	ProviderConfigName     string
+	Credentials            *providerCredentials
+	ProviderConfigVariants []providerConfigVariant
+	Endpoint               *EndpointConfig
+
+	// The effective output formats of the config map
+	OutputFormats []OutputFormat
+
+	// The shared ProviderConfig of the account, only set when enabled.
+	// SharedCredentials is nil when they are invalid.
+	SharedProviderConfigName string
+	SharedCredentials        *providerCredentials
+
+	// Labels and annotations of the objects generated for the cluster
+	Metadata propagatedMetadata
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DryRun {
+		r.Client = NewDryRunClient(r.Client, r.Recorder)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&capi.Cluster{}).
+		For(&capi.Cluster{}, builder.WithPredicates(managedClusterPredicate(r.Scope))).
+		Watches(
+			&apiextensionsv1.CustomResourceDefinition{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForAllClusters),
+			builder.OnlyMetadata,
+			builder.WithPredicates(crdPredicate()),
+		).
+		WatchesRawSource(r.configChangeSource()).
 		Complete(r)
 }
 
+// configChangeSource enqueues all clusters when the operator config changes,
+// see notifyConfigChanged.
+func (r *ConfigMapReconciler) configChangeSource() source.Source {
+	r.configChanges = make(chan event.GenericEvent, 1)
+	return source.Channel(
+		r.configChanges,
+		handler.EnqueueRequestsFromMapFunc(r.requestsForAllClusters),
+	)
+}
+
 func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
-	clusterInfo := &ClusterInfo{}
+	r.settingsLock.RLock()
+	defer r.settingsLock.RUnlock()
+
+	if r.DryRun {
+		var report *dryRunReport
+		ctx, report = startDryRunReport(ctx, req.NamespacedName)
+		defer report.publish()
+	}
 
 	cluster := &capi.Cluster{}
 	err := r.Client.Get(ctx, req.NamespacedName, cluster)
+	if k8serrors.IsNotFound(err) && r.Scope.Selector != nil && r.APIReader != nil {
+		// The cache only holds the selected clusters, a cluster whose labels no
+		// longer match is read from the API server to clean up after it.
+		err = r.APIReader.Get(ctx, req.NamespacedName, cluster)
+	}
 
 	if err != nil {
 		logger.Error(err, "failed to get cluster")
@@ -92,146 +232,47 @@ func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return r.reconcileDelete(ctx, cluster)
 	}
 
-	if IsEKS(*cluster) {
-		awsManagedControlPlane := &eks.AWSManagedControlPlane{}
-		err := r.Client.Get(ctx, req.NamespacedName, awsManagedControlPlane)
-		if err != nil {
-			logger.Error(err, "failed to get cluster")
-			return ctrl.Result{}, errors.WithStack(client.IgnoreNotFound(err))
-		}
-
-		clusterInfo.Name = awsManagedControlPlane.Name
-		clusterInfo.Namespace = awsManagedControlPlane.Namespace
-		clusterInfo.Region = awsManagedControlPlane.Spec.Region
-		clusterInfo.AWSPartition = getPartition(clusterInfo.Region)
-		clusterInfo.VpcID = awsManagedControlPlane.Spec.NetworkSpec.VPC.ID
-		clusterInfo.RoleArn, err = r.getRoleArn(ctx, awsManagedControlPlane.Spec.IdentityRef.Name, awsManagedControlPlane.Namespace)
-		if err != nil {
-			logger.Error(err, "failed to get cluster role identity")
-			return ctrl.Result{}, errors.WithStack(client.IgnoreNotFound(err))
-		}
-		eksId, err := getEKSId(awsManagedControlPlane.Spec.ControlPlaneEndpoint.Host)
-		if err != nil {
-			logger.Error(err, "failed to get EKS Cluster ID")
-			return ctrl.Result{}, errors.WithStack(client.IgnoreNotFound(err))
-		}
-
-		dnsSuffix := "amazonaws.com"
-
-		if clusterInfo.Region == "cn-north-1" || clusterInfo.Region == "cn-northwest-1" {
-			dnsSuffix = "amazonaws.com.cn"
-		}
-
-		clusterInfo.OIDCDomain = "oidc.eks." + clusterInfo.Region + "." + dnsSuffix + "/id/" + eksId
-		clusterInfo.OIDCDomains = []string{clusterInfo.OIDCDomain}
-
-	} else {
-		awsCluster := &capa.AWSCluster{}
-		err = r.Client.Get(ctx, req.NamespacedName, awsCluster)
-		if err != nil {
-			logger.Error(err, "failed to get cluster")
-			return ctrl.Result{}, errors.WithStack(client.IgnoreNotFound(err))
-		}
-		clusterInfo.Name = awsCluster.Name
-		clusterInfo.Namespace = awsCluster.Namespace
-		clusterInfo.Region = awsCluster.Spec.Region
-		clusterInfo.AWSPartition = getPartition(clusterInfo.Region)
-		clusterInfo.VpcID = awsCluster.Spec.NetworkSpec.VPC.ID
-		clusterInfo.RoleArn, err = r.getRoleArn(ctx, awsCluster.Spec.IdentityRef.Name, awsCluster.Namespace)
-		if err != nil {
-			logger.Error(err, "failed to get cluster role identity")
-			return ctrl.Result{}, errors.WithStack(client.IgnoreNotFound(err))
-		}
-
-		// May not apply to all clusters (e.g. different in China region), so we prefer reading the actual values
-		// from the `AWSCluster` annotation
-		computedIRSADomain := "irsa." + clusterInfo.Name + "." + r.BaseDomain
-		irsaTrustDomains := getIRSATrustDomains(awsCluster, computedIRSADomain)
-		clusterInfo.OIDCDomain = irsaTrustDomains[0]
-		clusterInfo.OIDCDomains = irsaTrustDomains
-
-		clusterInfo.SecurityGroups = &crossplaneConfigValuesAWSClusterSecurityGroups{}
-
-		if sg, ok := awsCluster.Status.Network.SecurityGroups[capa.SecurityGroupControlPlane]; ok {
-			clusterInfo.SecurityGroups.ControlPlane = &crossplaneConfigValuesAWSClusterSecurityGroup{
-				ID: sg.ID,
-			}
+	if !r.Scope.Contains(cluster) {
+		if controllerutil.ContainsFinalizer(cluster, Finalizer) {
+			// Otherwise no instance removes the finalizer once the cluster is
+			// deleted. An instance selecting the cluster now recreates the
+			// objects when it sees the finalizer removed.
+			logger.Info("Cluster left the scope, cleaning up")
+			return r.reconcileDelete(ctx, cluster)
 		}
+		logger.Info("Cluster is out of scope, skipping")
+		return ctrl.Result{}, nil
+	}
 
-		if sg, ok := awsCluster.Status.Network.SecurityGroups[capa.SecurityGroupNode]; ok {
-			clusterInfo.SecurityGroups.Node = &crossplaneConfigValuesAWSClusterSecurityGroup{
-				ID: sg.ID,
-			}
+	if !IsAWSCluster(cluster) {
+		if controllerutil.ContainsFinalizer(cluster, Finalizer) {
+			logger.Info("Cluster is not an AWS cluster, cleaning up")
+			return r.reconcileDelete(ctx, cluster)
 		}
+		logger.Info("Cluster is not an AWS cluster, skipping")
+		return ctrl.Result{}, nil
 	}
 
-	return r.reconcileNormal(ctx, clusterInfo)
-}
-
-func IsEKS(cluster capi.Cluster) bool {
-	return cluster.Spec.ControlPlaneRef != nil &&
-		cluster.Spec.ControlPlaneRef.Kind == "AWSManagedControlPlane"
-}
-
-func getEKSId(urlString string) (string, error) {
-	u, err := url.Parse(urlString)
-	if err != nil {
-		return "", err
+	resolver := r.getClusterInfoResolvers().Get(cluster)
+	if resolver == nil {
+		logger.Info("No cluster info resolver matches the cluster, skipping")
+		return ctrl.Result{}, nil
 	}
 
-	// The host part of the URL is in the form of "ED3AA07D016EA49EEBC31AB274E7F3DD.sk1.eu-west-2.eks.amazonaws.com"
-	// We can split it by '.' and take the first part
-	parts := strings.Split(u.Hostname(), ".")
-	if len(parts) > 0 {
-		return parts[0], nil
+	clusterInfo, err := resolver.Resolve(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to resolve cluster info")
+		return ctrl.Result{}, errors.WithStack(client.IgnoreNotFound(err))
 	}
 
-	return "", fmt.Errorf("unable to extract ID from URL")
+	return r.reconcileNormal(ctx, clusterInfo)
 }
 
-func getIRSATrustDomains(awsCluster *capa.AWSCluster, fallbackComputedDomain string) []string {
-	annotations := awsCluster.GetAnnotations()
-	if annotations == nil {
-		annotations = map[string]string{}
-	}
-	if s := annotations["aws.giantswarm.io/irsa-trust-domains"]; s != "" {
-		irsaTrustDomains := []string{}
-		values := strings.Split(s, ",")
-		for _, value := range values {
-			value = strings.TrimSpace(value)
-			if value != "" && !slices.Contains(irsaTrustDomains, value) {
-				irsaTrustDomains = append(irsaTrustDomains, value)
-			}
-		}
-		if len(irsaTrustDomains) > 0 {
-			return irsaTrustDomains
-		}
+func (r *ConfigMapReconciler) getClusterInfoResolvers() *ClusterInfoResolvers {
+	if r.ClusterInfoResolvers != nil {
+		return r.ClusterInfoResolvers
 	}
-	return []string{fallbackComputedDomain}
-}
-
-func (r *ConfigMapReconciler) getRoleArn(ctx context.Context, idRef string, namespace string) (arn.ARN, error) {
-	logger := log.FromContext(ctx)
-	identity := &capa.AWSClusterRoleIdentity{}
-	err := r.Client.Get(
-		ctx,
-		types.NamespacedName{
-			Name:      idRef,
-			Namespace: namespace,
-		},
-		identity,
-	)
-	if err != nil {
-		return arn.ARN{}, errors.WithStack(err)
-	}
-
-	roleARN, err := arn.Parse(identity.Spec.RoleArn)
-	if err != nil {
-		logger.Error(err, "failed to parse role arn")
-		return arn.ARN{}, errors.WithStack(err)
-	}
-
-	return roleARN, nil
+	return DefaultClusterInfoResolvers(r.Client, r.BaseDomain)
 }
 
 func (r *ConfigMapReconciler) reconcileNormal(ctx context.Context, clusterInfo *ClusterInfo) (ctrl.Result, error) {
@@ -255,21 +296,158 @@ func (r *ConfigMapReconciler) reconcileNormal(ctx context.Context, clusterInfo *
 		return ctrl.Result{}, errors.WithStack(err)
 	}
 
-	err = r.reconcileConfigMap(ctx, clusterInfo, clusterInfo.RoleArn.AccountID, r.BaseDomain)
+	// The finalizer on the Cluster now guards the clean up
+	err = r.removeLegacyFinalizer(ctx, capiCluster)
+	if err != nil {
+		logger.Error(err, "failed to remove legacy finalizer")
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	patchHelper, err := patch.NewHelper(capiCluster, r.Client)
 	if err != nil {
-		logger.Error(err, "failed to reconcile config map")
+		logger.Error(err, "failed to create patch helper")
 		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	accountID, err := getAccountID(capiCluster, clusterInfo)
+	if err != nil {
+		logger.Error(err, "invalid account id override")
+		conditions.MarkFalse(capiCluster, ConfigMapReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityError, "%s", err)
+		conditions.MarkFalse(capiCluster, ProviderConfigReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityError, "%s", err)
+		return ctrl.Result{}, r.patchConditions(ctx, patchHelper, capiCluster)
+	}
+
+	names, err := r.getObjectNames(capiCluster, accountID)
+	if err != nil {
+		logger.Error(err, "invalid object name override")
+		conditions.MarkFalse(capiCluster, ConfigMapReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityError, "%s", err)
+		conditions.MarkFalse(capiCluster, ProviderConfigReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityError, "%s", err)
+		return ctrl.Result{}, r.patchConditions(ctx, patchHelper, capiCluster)
+	}
+	clusterInfo.ProviderConfigName = names.ProviderConfig
+	validConfigMapNamespace := true
+	err = r.checkConfigMapNamespace(capiCluster, names.ConfigMap.Namespace)
+	if err != nil {
+		validConfigMapNamespace = false
+		logger.Error(err, "invalid config map namespace override")
+		conditions.MarkFalse(capiCluster, ConfigMapReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityError, "%s", err)
+	}
+	clusterInfo.Metadata = r.getPropagatedMetadata(capiCluster, accountID, clusterInfo.Region)
+
+	var outputFormatsErr error
+	clusterInfo.OutputFormats, outputFormatsErr = r.getOutputFormats(capiCluster)
+	if outputFormatsErr != nil {
+		logger.Error(outputFormatsErr, "invalid output formats override, using the default formats")
+	}
+
+	validSharedCredentials := false
+	if r.sharedProviderConfigEnabled() {
+		clusterInfo.SharedProviderConfigName = getSharedProviderConfigName(accountID)
+		sharedCredentials, err := r.resolveSharedCredentials(accountID, clusterInfo.Region)
+		validSharedCredentials = err == nil
+		if validSharedCredentials {
+			clusterInfo.SharedCredentials = &sharedCredentials
+		} else {
+			logger.Error(err, "invalid shared provider config credentials")
+			conditions.MarkFalse(capiCluster, SharedProviderConfigReadyCondition, InvalidCredentialsReason, capi.ConditionSeverityError, "%s", err)
+		}
+	} else {
+		conditions.Delete(capiCluster, SharedProviderConfigReadyCondition)
+	}
 
+	validProviderConfig := false
+	if r.SharedProviderConfig == SharedProviderConfigInstead {
+		// The clusters of the account only use the shared provider config
+		clusterInfo.ProviderConfigName = clusterInfo.SharedProviderConfigName
+		clusterInfo.Credentials = clusterInfo.SharedCredentials
+		clusterInfo.Endpoint = r.Endpoint
+		conditions.Delete(capiCluster, ProviderConfigReadyCondition)
+	} else {
+		credentials, err := r.resolveCredentials(capiCluster, accountID, clusterInfo.Region)
+		if err == nil {
+			clusterInfo.Credentials = &credentials
+			clusterInfo.ProviderConfigVariants, err = r.resolveProviderConfigVariants(capiCluster, names.ProviderConfig, credentials, accountID, clusterInfo.Region)
+		}
+		// Invalid settings leave the existing provider configs untouched
+		validProviderConfig = err == nil
+		if !validProviderConfig {
+			logger.Error(err, "invalid provider config credentials")
+			conditions.MarkFalse(capiCluster, ProviderConfigReadyCondition, InvalidCredentialsReason, capi.ConditionSeverityError, "%s", err)
+		} else {
+			clusterInfo.Endpoint, err = r.getEndpointConfig(capiCluster)
+			if err != nil {
+				validProviderConfig = false
+				logger.Error(err, "invalid provider config endpoint")
+				conditions.MarkFalse(capiCluster, ProviderConfigReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityError, "%s", err)
+			}
+		}
 	}
 
-	err = r.reconcileProviderConfig(ctx, clusterInfo, clusterInfo.RoleArn.AccountID)
+	// A rejected namespace leaves the existing config map untouched
+	if validConfigMapNamespace {
+		err = r.reconcileConfigMap(ctx, capiCluster, clusterInfo, names.ConfigMap, accountID, r.BaseDomain)
+		if err != nil {
+			logger.Error(err, "failed to reconcile config map")
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+		if outputFormatsErr != nil && conditions.IsTrue(capiCluster, ConfigMapReadyCondition) {
+			conditions.MarkFalse(capiCluster, ConfigMapReadyCondition, InvalidAnnotationReason, capi.ConditionSeverityWarning,
+				"%s, wrote the default output formats", outputFormatsErr)
+		}
+	}
+
+	if r.SharedProviderConfig == SharedProviderConfigInstead {
+		err = r.deleteProviderConfigs(ctx, capiCluster)
+		if err != nil {
+			logger.Error(err, "failed to delete provider configs")
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+	} else if validProviderConfig {
+		err = r.reconcileProviderConfigs(ctx, capiCluster, clusterInfo)
+		if err != nil {
+			logger.Error(err, "failed to reconcile provider config")
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+	}
+
+	if validSharedCredentials {
+		err = r.reconcileSharedProviderConfig(ctx, capiCluster, clusterInfo, accountID)
+		if err != nil {
+			logger.Error(err, "failed to reconcile shared provider config")
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+	} else if !r.sharedProviderConfigEnabled() {
+		err = r.releaseSharedProviderConfigs(ctx, capiCluster)
+		if err != nil {
+			logger.Error(err, "failed to release shared provider configs")
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+	}
+
+	err = r.reconcileEnvironmentConfig(ctx, capiCluster, clusterInfo, names.EnvironmentConfig, accountID, r.BaseDomain)
+	if err != nil {
+		logger.Error(err, "failed to reconcile environment config")
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	err = r.reconcileWorkloadProviderConfigs(ctx, capiCluster, clusterInfo, names.ProviderConfig)
 	if err != nil {
-		logger.Error(err, "failed to reconcile provider config")
+		logger.Error(err, "failed to reconcile workload provider configs")
 		return ctrl.Result{}, errors.WithStack(err)
+	}
 
+	requeueAfter := markInfrastructureReadyCondition(capiCluster, clusterInfo)
+	if requeueAfter > 0 {
+		logger.Info("Waiting for infrastructure", "missing", clusterInfo.Missing, "requeueAfter", requeueAfter)
 	}
 
-	return ctrl.Result{}, nil
+	err = r.patchConditions(ctx, patchHelper, capiCluster)
+	if err != nil {
+		logger.Error(err, "failed to patch cluster conditions")
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
 type crossplaneConfigValues struct {
@@ -283,12 +461,38 @@ type crossplaneConfigValues struct {
 	// For backward compatibility, we still export the primary domain as singular-named field `oidcDomain`
 	OIDCDomain  string   `json:"oidcDomain"`
 	OIDCDomains []string `json:"oidcDomains"`
+
+	// Whether all required values are known. Missing lists the ones that are
+	// not known yet.
+	Ready   bool     `json:"ready"`
+	Missing []string `json:"missing,omitempty"`
+
+	// The effective ProviderConfig settings of the cluster
+	ProviderConfig crossplaneConfigValuesProviderConfig `json:"providerConfig"`
+}
+
+type crossplaneConfigValuesProviderConfig struct {
+	Name              string                                        `json:"name"`
+	CredentialsSource string                                        `json:"credentialsSource,omitempty"`
+	RoleARN           string                                        `json:"roleARN,omitempty"`
+	Variants          []crossplaneConfigValuesProviderConfigVariant `json:"variants,omitempty"`
+	// Name of the ProviderConfig shared by the clusters of the account
+	SharedName string `json:"sharedName,omitempty"`
+	// URL of the endpoint override
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type crossplaneConfigValuesProviderConfigVariant struct {
+	Name            string   `json:"name"`
+	RoleARN         string   `json:"roleARN,omitempty"`
+	AssumeRoleChain []string `json:"assumeRoleChain,omitempty"`
 }
 
 type crossplaneConfigValuesAWSCluster struct {
 	// Filled once available
 	VpcID          string                                          `json:"vpcId,omitempty"`
 	SecurityGroups *crossplaneConfigValuesAWSClusterSecurityGroups `json:"securityGroups,omitempty"`
+	Subnets        []string                                        `json:"subnets,omitempty"`
 }
 
 type crossplaneConfigValuesAWSClusterSecurityGroups struct {
@@ -303,47 +507,174 @@ type crossplaneConfigValuesAWSClusterSecurityGroup struct {
 
 func (r *ConfigMapReconciler) reconcileConfigMap(
 	ctx context.Context,
+	cluster *capi.Cluster,
 	clusterInfo *ClusterInfo,
+	name types.NamespacedName,
 	accountID, baseDomain string,
 ) error {
+	logger := log.FromContext(ctx)
+
 	config := &corev1.ConfigMap{}
-	err := r.Client.Get(ctx,
-		types.NamespacedName{
-			Name:      fmt.Sprintf("%s-crossplane-config", clusterInfo.Name),
-			Namespace: clusterInfo.Namespace,
-		},
-		config,
-	)
+	err := r.Client.Get(ctx, name, config)
 
 	if k8serrors.IsNotFound(err) {
-		return r.createConfigMap(ctx, clusterInfo, accountID, baseDomain)
+		err = r.createConfigMap(ctx, cluster, clusterInfo, name, accountID, baseDomain)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		conditions.MarkTrue(cluster, ConfigMapReadyCondition)
+		return r.deleteStaleConfigMaps(ctx, cluster, name)
 	}
+	if err != nil {
+		logger.Error(err, "failed to get config map")
+		return errors.WithStack(err)
+	}
+
+	if !isManaged(config) && !isAdoptable(config) {
+		logger.Info("config map is not managed by the operator, refusing to update it")
+		conditions.MarkFalse(cluster, ConfigMapReadyCondition, OwnershipConflictReason, capi.ConditionSeverityWarning,
+			"ConfigMap %s/%s is not managed by %s, annotate it with %s=true to adopt it",
+			config.Namespace, config.Name, ManagedByValue, AdoptAnnotation)
+		return nil
+	}
+
+	err = r.updateConfigMap(ctx, cluster, clusterInfo, config, accountID, baseDomain)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	conditions.MarkTrue(cluster, ConfigMapReadyCondition)
 
-	return r.updateConfigMap(ctx, clusterInfo, config, accountID, baseDomain)
+	return r.deleteStaleConfigMaps(ctx, cluster, name)
 }
 
-func (r *ConfigMapReconciler) reconcileProviderConfig(ctx context.Context, clusterInfo *ClusterInfo, accountID string) error {
+// deleteStaleConfigMaps removes config maps generated for the cluster under a
+// different name or namespace, e.g. after the name template changed.
+func (r *ConfigMapReconciler) deleteStaleConfigMaps(ctx context.Context, cluster *capi.Cluster, current types.NamespacedName) error {
 	logger := log.FromContext(ctx)
 
-	providerConfig := getProviderConfig(clusterInfo.Name, clusterInfo.Namespace)
+	configMaps := &corev1.ConfigMapList{}
+	err := r.Client.List(ctx, configMaps, ownedBy(cluster.Name, cluster.Namespace))
+	if err != nil {
+		logger.Error(err, "failed to list config maps")
+		return errors.WithStack(err)
+	}
 
-	err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      clusterInfo.Name,
-		Namespace: clusterInfo.Namespace,
-	}, providerConfig)
+	for i := range configMaps.Items {
+		config := &configMaps.Items[i]
+		if config.Name == current.Name && config.Namespace == current.Namespace {
+			continue
+		}
+
+		logger.Info("Deleting stale ConfigMap", "configMap", client.ObjectKeyFromObject(config))
+		err = r.Client.Delete(ctx, config)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logger.Error(err, "failed to delete stale config map")
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileProviderConfigs maintains the default ProviderConfig of the
+// cluster and its variants.
+func (r *ConfigMapReconciler) reconcileProviderConfigs(ctx context.Context, cluster *capi.Cluster, clusterInfo *ClusterInfo) error {
+	logger := log.FromContext(ctx)
+
+	mapping, err := r.getProviderConfigMapping(r.Client.RESTMapper())
 	if metaerr.IsNoMatchError(err) {
 		logger.Info("Provider config CRD not found, skipping provider config creation")
+		conditions.MarkFalse(cluster, ProviderConfigReadyCondition, ProviderConfigAPIUnavailableReason, capi.ConditionSeverityInfo,
+			"No supported ProviderConfig API is served, install provider-aws to create it")
 		return nil
 	}
+	if err != nil {
+		logger.Error(err, "Failed to discover provider config api")
+		return errors.WithStack(err)
+	}
+
+	desired := append([]providerConfigVariant{{
+		Name:        clusterInfo.ProviderConfigName,
+		Credentials: *clusterInfo.Credentials,
+	}}, clusterInfo.ProviderConfigVariants...)
+
+	providerConfigs := make([]*unstructured.Unstructured, 0, len(desired))
+	desiredSpecs := make([]map[string]interface{}, 0, len(desired))
+	for _, variant := range desired {
+		providerConfig := getProviderConfig(mapping, variant.Name, cluster)
+		desiredSpec, err := getProviderConfigSpec(variant.Credentials, providerConfig.GetNamespace())
+		if err != nil {
+			// Invalid credentials leave the existing provider configs untouched
+			logger.Error(err, "invalid provider config credentials")
+			conditions.MarkFalse(cluster, ProviderConfigReadyCondition, InvalidCredentialsReason, capi.ConditionSeverityError, "%s", err)
+			return nil
+		}
+		setEndpoint(desiredSpec, clusterInfo.Endpoint)
+		providerConfigs = append(providerConfigs, providerConfig)
+		desiredSpecs = append(desiredSpecs, desiredSpec)
+	}
+
+	kept := []*unstructured.Unstructured{}
+	conflicts := []string{}
+	for i, variant := range desired {
+		providerConfig := providerConfigs[i]
+		managed, err := r.reconcileProviderConfig(ctx, clusterInfo, providerConfig, desiredSpecs[i])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !managed {
+			conflicts = append(conflicts, variant.Name)
+			continue
+		}
+		kept = append(kept, providerConfig)
+	}
+
+	if len(conflicts) > 0 {
+		conditions.MarkFalse(cluster, ProviderConfigReadyCondition, OwnershipConflictReason, capi.ConditionSeverityWarning,
+			"ProviderConfigs %v are not managed by %s, annotate them with %s=true to adopt them",
+			conflicts, ManagedByValue, AdoptAnnotation)
+	} else {
+		conditions.MarkTrue(cluster, ProviderConfigReadyCondition)
+	}
+
+	return r.deleteProviderConfigs(ctx, cluster, kept...)
+}
+
+// reconcileProviderConfig creates or updates a single ProviderConfig. It
+// returns false when the ProviderConfig exists and is not managed by the
+// operator.
+func (r *ConfigMapReconciler) reconcileProviderConfig(ctx context.Context, clusterInfo *ClusterInfo, providerConfig *unstructured.Unstructured, desiredSpec map[string]interface{}) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("providerConfig", providerConfig.GetName())
+
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(providerConfig), providerConfig)
 	if k8serrors.IsNotFound(err) {
-		return r.createProviderConfig(ctx, providerConfig, accountID, clusterInfo.Region)
+		err = r.createProviderConfig(ctx, clusterInfo, providerConfig, desiredSpec)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
 	}
 	if err != nil {
 		logger.Error(err, "Failed to get provider config")
-		return errors.WithStack(err)
+		return false, errors.WithStack(err)
+	}
+
+	// Versions of the operator before the ownership check did not label
+	// provider configs. Those are recognised by having exactly the spec the
+	// operator would render, so adopting them does not change any credentials.
+	if !isManaged(providerConfig) && !isAdoptable(providerConfig) &&
+		!equality.Semantic.DeepEqual(providerConfig.Object["spec"], desiredSpec) {
+
+		logger.Info("provider config is not managed by the operator, refusing to update it")
+		return false, nil
 	}
 
-	return r.updateProviderConfig(ctx, providerConfig, accountID, clusterInfo.Region)
+	err = r.updateProviderConfig(ctx, clusterInfo, providerConfig, desiredSpec)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
 }
 
 func (r *ConfigMapReconciler) reconcileDelete(ctx context.Context, cluster *capi.Cluster) (ctrl.Result, error) {
@@ -351,28 +682,50 @@ func (r *ConfigMapReconciler) reconcileDelete(ctx context.Context, cluster *capi
 	logger.Info("Reconcile delete")
 	defer logger.Info("Done deleting")
 
-	config := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
-			Namespace: cluster.Namespace,
-		},
+	configMaps := &corev1.ConfigMapList{}
+	err := r.Client.List(ctx, configMaps, ownedBy(cluster.Name, cluster.Namespace))
+	if err != nil {
+		logger.Error(err, "failed to list config maps")
+		return ctrl.Result{}, errors.WithStack(err)
 	}
 
-	logger.Info("Deleting ConfigMap")
-	err := r.Client.Delete(ctx, config)
-	if err != nil && !k8serrors.IsNotFound(err) {
-		logger.Error(err, "failed to delete config map")
+	for i := range configMaps.Items {
+		config := &configMaps.Items[i]
+		logger.Info("Deleting ConfigMap", "configMap", client.ObjectKeyFromObject(config))
+		err = r.Client.Delete(ctx, config)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logger.Error(err, "failed to delete config map")
+			return ctrl.Result{}, errors.WithStack(err)
+		}
+	}
+
+	err = r.deleteProviderConfigs(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to delete provider configs")
 		return ctrl.Result{}, errors.WithStack(err)
 	}
 
-	providerConfig := getProviderConfig(cluster.Name, cluster.Namespace)
-	logger.Info("Deleting ProviderConfig")
-	err = r.Client.Delete(ctx, providerConfig)
-	if err != nil &&
-		!k8serrors.IsNotFound(err) &&
-		!metaerr.IsNoMatchError(err) {
+	err = r.deleteObjectsByName(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to delete objects by name")
+		return ctrl.Result{}, errors.WithStack(err)
+	}
 
-		logger.Error(err, "failed to delete provider config")
+	err = r.releaseSharedProviderConfigs(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to release shared provider configs")
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	err = r.deleteEnvironmentConfigs(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to delete environment configs")
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+
+	err = r.deleteWorkloadProviderConfigs(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "failed to delete workload provider configs")
 		return ctrl.Result{}, errors.WithStack(err)
 	}
 
@@ -393,24 +746,10 @@ func (r *ConfigMapReconciler) AddFinalizer(ctx context.Context, cluster *capi.Cl
 }
 
 func (r *ConfigMapReconciler) RemoveFinalizer(ctx context.Context, cluster *capi.Cluster) error {
-
-	// Check if there is an AWSCluster with the same name and namespace, and remove the finalizer. This enables the migration of the finalizer from `AWSCluster` to `Cluster`.
-	awsCluster := &capa.AWSCluster{}
-	err := r.Client.Get(ctx, types.NamespacedName{
-		Name:      cluster.Name,
-		Namespace: cluster.Namespace,
-	}, awsCluster)
-	if client.IgnoreNotFound(err) != nil {
+	err := r.removeLegacyFinalizer(ctx, cluster)
+	if err != nil {
 		return err
 	}
-	if err == nil {
-		originalAWSCluster := awsCluster.DeepCopy()
-		controllerutil.RemoveFinalizer(awsCluster, Finalizer)
-		err = r.Client.Patch(ctx, awsCluster, client.MergeFrom(originalAWSCluster))
-		if err != nil {
-			return err
-		}
-	}
 
 	originalCluster := cluster.DeepCopy()
 	controllerutil.RemoveFinalizer(cluster, Finalizer)
@@ -422,27 +761,52 @@ func (r *ConfigMapReconciler) RemoveFinalizer(ctx context.Context, cluster *capi
 	return err
 }
 
-func (r *ConfigMapReconciler) createConfigMap(ctx context.Context, clusterInfo *ClusterInfo, accountID, baseDomain string) error {
+// removeLegacyFinalizer removes the finalizer of older releases from the
+// AWSCluster with the same name and namespace. This completes the migration of
+// the finalizer from `AWSCluster` to `Cluster`.
+func (r *ConfigMapReconciler) removeLegacyFinalizer(ctx context.Context, cluster *capi.Cluster) error {
+	awsCluster := &capa.AWSCluster{}
+	err := r.Client.Get(ctx, types.NamespacedName{
+		Name:      cluster.Name,
+		Namespace: cluster.Namespace,
+	}, awsCluster)
+	if k8serrors.IsNotFound(err) || metaerr.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !controllerutil.ContainsFinalizer(awsCluster, Finalizer) {
+		return nil
+	}
+
+	originalAWSCluster := awsCluster.DeepCopy()
+	controllerutil.RemoveFinalizer(awsCluster, Finalizer)
+	return r.Client.Patch(ctx, awsCluster, client.MergeFrom(originalAWSCluster))
+}
+
+func (r *ConfigMapReconciler) createConfigMap(ctx context.Context, cluster *capi.Cluster, clusterInfo *ClusterInfo, name types.NamespacedName, accountID, baseDomain string) error {
 	logger := log.FromContext(ctx)
 
 	logger.Info("Creating config map")
-	configMapValues, err := getConfigMapValues(clusterInfo, accountID, baseDomain)
+	data, failed, err := r.getConfigMapData(cluster, clusterInfo, accountID, baseDomain)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	r.markValuesTemplatesCondition(ctx, cluster, failed)
 
 	config := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-crossplane-config", clusterInfo.Name),
-			Namespace: clusterInfo.Namespace,
+			Name:      name.Name,
+			Namespace: name.Namespace,
 			Labels: map[string]string{
-				"app.kubernetes.io/managed-by": "aws-crossplane-cluster-config-operator",
+				ManagedByLabel: ManagedByValue,
 			},
 		},
-		Data: map[string]string{
-			"values": configMapValues,
-		},
+		Data: data,
 	}
+	setClusterLabels(config, clusterInfo.Name, clusterInfo.Namespace)
+	setPropagatedMetadata(config, clusterInfo.Metadata)
 
 	err = r.Client.Create(ctx, config)
 	if k8serrors.IsAlreadyExists(err) {
@@ -458,18 +822,33 @@ func (r *ConfigMapReconciler) createConfigMap(ctx context.Context, clusterInfo *
 }
 
 func (r *ConfigMapReconciler) updateConfigMap(ctx context.Context,
+	cluster *capi.Cluster,
 	clusterInfo *ClusterInfo,
 	config *corev1.ConfigMap,
 	accountID, baseDomain string,
 ) error {
 	logger := log.FromContext(ctx)
 
-	configMapValues, err := getConfigMapValues(clusterInfo, accountID, baseDomain)
+	data, failed, err := r.getConfigMapData(cluster, clusterInfo, accountID, baseDomain)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	r.markValuesTemplatesCondition(ctx, cluster, failed)
+
+	// Keep the last successfully rendered content of keys whose template
+	// failed, so a broken template does not take the value away from
+	// consumers.
+	for key := range failed {
+		if value, ok := config.Data[key]; ok {
+			data[key] = value
+		}
+	}
+
 	patchedConfig := config.DeepCopy()
-	patchedConfig.Data["values"] = configMapValues
+	setManaged(patchedConfig)
+	setClusterLabels(patchedConfig, clusterInfo.Name, clusterInfo.Namespace)
+	setPropagatedMetadata(patchedConfig, clusterInfo.Metadata)
+	patchedConfig.Data = data
 
 	err = r.Client.Patch(ctx, patchedConfig, client.MergeFrom(config))
 	if err != nil {
@@ -480,10 +859,67 @@ func (r *ConfigMapReconciler) updateConfigMap(ctx context.Context,
 	return nil
 }
 
-func (r *ConfigMapReconciler) createProviderConfig(ctx context.Context, providerConfig *unstructured.Unstructured, accountID, region string) error {
+// getConfigMapData returns the built-in values in all configured formats and
+// the output of the values templates. Templates failing to render are returned
+// separately.
+func (r *ConfigMapReconciler) getConfigMapData(cluster *capi.Cluster, clusterInfo *ClusterInfo, accountID, baseDomain string) (map[string]string, map[string]error, error) {
+	values := getCrossplaneConfigValues(clusterInfo, accountID, baseDomain)
+	configMapValues, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	formatted, err := renderOutputFormats(values, clusterInfo.OutputFormats)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	data, failed := renderValuesTemplates(r.ValuesTemplates, valuesTemplateData{
+		ClusterInfo:            clusterInfo,
+		Values:                 values,
+		Cluster:                cluster,
+		AWSCluster:             clusterInfo.AWSCluster,
+		AWSManagedControlPlane: clusterInfo.AWSManagedControlPlane,
+		ROSAControlPlane:       clusterInfo.ROSAControlPlane,
+	})
+	// The built-in keys take precedence over values templates using the same key.
+	for key, value := range formatted {
+		data[key] = value
+	}
+	data[ValuesKey] = string(configMapValues)
+
+	return data, failed, nil
+}
+
+func (r *ConfigMapReconciler) markValuesTemplatesCondition(ctx context.Context, cluster *capi.Cluster, failed map[string]error) {
 	logger := log.FromContext(ctx)
 
-	providerConfig.Object["spec"] = r.getProviderConfigSpec(accountID, region)
+	if len(r.ValuesTemplates) == 0 {
+		conditions.Delete(cluster, ValuesTemplatesRenderedCondition)
+		return
+	}
+
+	if len(failed) == 0 {
+		conditions.MarkTrue(cluster, ValuesTemplatesRenderedCondition)
+		return
+	}
+
+	messages := []string{}
+	for _, key := range failedKeys(failed) {
+		logger.Error(failed[key], "failed to render values template", "key", key)
+		messages = append(messages, fmt.Sprintf("%s: %s", key, failed[key]))
+	}
+	conditions.MarkFalse(cluster, ValuesTemplatesRenderedCondition, TemplateRenderFailedReason, capi.ConditionSeverityWarning,
+		"%s", strings.Join(messages, "; "))
+}
+
+func (r *ConfigMapReconciler) createProviderConfig(ctx context.Context, clusterInfo *ClusterInfo, providerConfig *unstructured.Unstructured, spec map[string]interface{}) error {
+	logger := log.FromContext(ctx)
+
+	setManaged(providerConfig)
+	setClusterLabels(providerConfig, clusterInfo.Name, clusterInfo.Namespace)
+	setPropagatedMetadata(providerConfig, clusterInfo.Metadata)
+	providerConfig.Object["spec"] = spec
 
 	err := r.Client.Create(ctx, providerConfig)
 	if k8serrors.IsAlreadyExists(err) {
@@ -498,11 +934,14 @@ func (r *ConfigMapReconciler) createProviderConfig(ctx context.Context, provider
 	return nil
 }
 
-func (r *ConfigMapReconciler) updateProviderConfig(ctx context.Context, providerConfig *unstructured.Unstructured, accountID, region string) error {
+func (r *ConfigMapReconciler) updateProviderConfig(ctx context.Context, clusterInfo *ClusterInfo, providerConfig *unstructured.Unstructured, spec map[string]interface{}) error {
 	logger := log.FromContext(ctx)
 
 	patchedConfig := providerConfig.DeepCopy()
-	patchedConfig.Object["spec"] = r.getProviderConfigSpec(accountID, region)
+	setManaged(patchedConfig)
+	setClusterLabels(patchedConfig, clusterInfo.Name, clusterInfo.Namespace)
+	setPropagatedMetadata(patchedConfig, clusterInfo.Metadata)
+	patchedConfig.Object["spec"] = spec
 	err := r.Client.Patch(ctx, patchedConfig, client.MergeFrom(providerConfig))
 	if err != nil {
 		logger.Error(err, "Failed to patch provider config")
@@ -512,62 +951,43 @@ func (r *ConfigMapReconciler) updateProviderConfig(ctx context.Context, provider
 	return nil
 }
 
-func (r *ConfigMapReconciler) getProviderConfigSpec(accountID, region string) map[string]interface{} {
-	partition := getPartition(region)
-	return map[string]interface{}{
-		"credentials": map[string]interface{}{
-			"source": "WebIdentity",
-			"webIdentity": map[string]interface{}{
-				"roleARN": fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, accountID, r.ProviderRole),
-			},
-		},
-	}
-}
-
-func getConfigMapValues(clusterInfo *ClusterInfo, accountID, baseDomain string) (string, error) {
+func getCrossplaneConfigValues(clusterInfo *ClusterInfo, accountID, baseDomain string) crossplaneConfigValues {
 	valuesAWSCluster := crossplaneConfigValuesAWSCluster{}
 	valuesAWSCluster.VpcID = clusterInfo.VpcID
 	valuesAWSCluster.SecurityGroups = clusterInfo.SecurityGroups
+	valuesAWSCluster.Subnets = clusterInfo.Subnets
 
-	values := crossplaneConfigValues{
+	valuesProviderConfig := crossplaneConfigValuesProviderConfig{
+		Name:       clusterInfo.ProviderConfigName,
+		SharedName: clusterInfo.SharedProviderConfigName,
+	}
+	if clusterInfo.Credentials != nil {
+		valuesProviderConfig.CredentialsSource = string(clusterInfo.Credentials.Source)
+		valuesProviderConfig.RoleARN = clusterInfo.Credentials.RoleARN
+	}
+	if clusterInfo.Endpoint != nil {
+		valuesProviderConfig.Endpoint = clusterInfo.Endpoint.URL
+	}
+	for _, variant := range clusterInfo.ProviderConfigVariants {
+		valuesProviderConfig.Variants = append(valuesProviderConfig.Variants, crossplaneConfigValuesProviderConfigVariant{
+			Name:            variant.Name,
+			RoleARN:         variant.Credentials.RoleARN,
+			AssumeRoleChain: variant.Credentials.AssumeRoleChain,
+		})
+	}
+
+	return crossplaneConfigValues{
 		AccountID:    accountID,
 		AWSCluster:   valuesAWSCluster,
 		AWSPartition: clusterInfo.AWSPartition,
 		BaseDomain:   fmt.Sprintf("%s.%s", clusterInfo.Name, baseDomain),
 		ClusterName:  clusterInfo.Name,
 		Region:       clusterInfo.Region,
-		OIDCDomain:   clusterInfo.OIDCDomains[0],
+		OIDCDomain:   clusterInfo.OIDCDomain,
 		OIDCDomains:  clusterInfo.OIDCDomains,
-	}
-
-	configMapValues, err := yaml.Marshal(values)
-	if err != nil {
-		return "", errors.WithStack(err)
-	}
-
-	return string(configMapValues), nil
-}
-
-func getProviderConfig(name string, namespace string) *unstructured.Unstructured {
-	providerConfig := &unstructured.Unstructured{}
-	providerConfig.Object = map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"name":      name,
-			"namespace": namespace,
-		},
-	}
-	providerConfig.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "aws.upbound.io",
-		Kind:    "ProviderConfig",
-		Version: "v1beta1",
-	})
-
-	return providerConfig
-}
+		Ready:        len(clusterInfo.Missing) == 0,
+		Missing:      clusterInfo.Missing,
 
-func getPartition(region string) string {
-	if strings.HasPrefix(region, "cn-") {
-		return "aws-cn"
+		ProviderConfig: valuesProviderConfig,
 	}
-	return "aws"
 }
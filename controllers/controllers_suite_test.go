@@ -23,6 +23,8 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/go-logr/logr"
@@ -32,12 +34,20 @@ import (
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/tools/go/packages"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/kubectl/pkg/scheme"
 	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
 	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -54,6 +64,14 @@ func TestControllers(t *testing.T) {
 	RunSpecs(t, "Controller Suite")
 }
 
+// unitLabel marks specs that do not need envtest, e.g. specs using a fake
+// client.
+const unitLabel = "unit"
+
+func isUnitSpec() bool {
+	return slices.Contains(CurrentSpecReport().Labels(), unitLabel)
+}
+
 var (
 	logger    logr.Logger
 	k8sClient client.Client
@@ -70,7 +88,11 @@ var _ = BeforeSuite(func() {
 	logger = zap.New(zap.UseFlagOptions(&opts))
 	logf.SetLogger(logger)
 
-	tests.GetEnvOrSkip("KUBEBUILDER_ASSETS")
+	// Specs labelled unitLabel run without envtest, all others are skipped
+	// in the BeforeEach below.
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		return
+	}
 
 	// We need to calculate the cluster-api version to load the CRDs from the right path
 	capiModule, err := packages.Load(&packages.Config{Mode: packages.NeedModule}, "sigs.k8s.io/cluster-api")
@@ -102,6 +124,9 @@ var _ = BeforeSuite(func() {
 	err = eks.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = rosa.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	err = capi.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 	// +kubebuilder:scaffold:scheme
@@ -121,6 +146,11 @@ var _ = AfterSuite(func() {
 })
 
 var _ = BeforeEach(func() {
+	if isUnitSpec() {
+		return
+	}
+	tests.GetEnvOrSkip("KUBEBUILDER_ASSETS")
+
 	namespace = uuid.New().String()
 	namespaceObj := &corev1.Namespace{}
 	namespaceObj.Name = namespace
@@ -128,6 +158,9 @@ var _ = BeforeEach(func() {
 })
 
 var _ = AfterEach(func() {
+	if isUnitSpec() || k8sClient == nil {
+		return
+	}
 	namespaceObj := &corev1.Namespace{}
 	namespaceObj.Name = namespace
 	Expect(k8sClient.Delete(context.Background(), namespaceObj)).To(Succeed())
@@ -236,6 +269,10 @@ func createRandomCapaClusterWithIdentity(annotationsKeyValues ...string) (*capa.
 	capiCluster := newCapiCluster(name, annotationsKeyValues...)
 	identity := newRoleIdentity()
 
+	capiCluster.Spec.InfrastructureRef = &corev1.ObjectReference{
+		Kind: "AWSCluster",
+	}
+
 	awsCluster.Spec.IdentityRef = &capa.AWSIdentityReference{
 		Name: identity.Name,
 		Kind: "AWSClusterRoleIdentity",
@@ -301,3 +338,141 @@ func newRoleIdentity() *capa.AWSClusterRoleIdentity {
 		},
 	}
 }
+
+// fakeCrossplaneKinds are the Crossplane kinds installed in the fake
+// management cluster.
+var fakeCrossplaneKinds = map[schema.GroupVersionKind]meta.RESTScope{
+	{Group: "aws.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}:                 meta.RESTScopeRoot,
+	{Group: "apiextensions.crossplane.io", Version: "v1beta1", Kind: "EnvironmentConfig"}: meta.RESTScopeRoot,
+}
+
+// newFakeManagementClient returns a fake client of a management cluster with
+// the Crossplane kinds the reconciler writes installed.
+func newFakeManagementClient(objs ...client.Object) client.Client {
+	return newFakeManagementClientWithKinds(fakeCrossplaneKinds, objs...)
+}
+
+// newFakeManagementClientWithKinds returns a fake client of a management
+// cluster with only the given Crossplane kinds installed.
+func newFakeManagementClientWithKinds(kinds map[schema.GroupVersionKind]meta.RESTScope, objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(capi.AddToScheme(scheme)).To(Succeed())
+	Expect(capa.AddToScheme(scheme)).To(Succeed())
+	Expect(eks.AddToScheme(scheme)).To(Succeed())
+
+	groupVersions := []schema.GroupVersion{}
+	for gvk := range kinds {
+		groupVersions = append(groupVersions, gvk.GroupVersion())
+	}
+
+	mapper := meta.NewDefaultRESTMapper(groupVersions)
+	for gvk, scope := range kinds {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+		mapper.Add(gvk, scope)
+	}
+
+	// The fake client stores unstructured objects of any kind, an API server
+	// does not know the kinds whose CRD is not installed
+	checkKind := func(obj runtime.Object) error {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if _, ok := obj.(*unstructured.UnstructuredList); ok {
+			gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+		} else if _, ok := obj.(*unstructured.Unstructured); !ok {
+			return nil
+		}
+		_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		return err
+	}
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(mapper).
+		WithObjects(objs...).
+		WithStatusSubresource(&capi.Cluster{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if err := checkKind(obj); err != nil {
+					return err
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+			List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if err := checkKind(list); err != nil {
+					return err
+				}
+				return c.List(ctx, list, opts...)
+			},
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if err := checkKind(obj); err != nil {
+					return err
+				}
+				return c.Create(ctx, obj, opts...)
+			},
+		}).
+		Build()
+}
+
+// newFakeCapaCluster returns the objects of the CAPA cluster acme in the
+// namespace org-acme with the account 123456789012 and all values known.
+func newFakeCapaCluster(annotationsKeyValues ...string) (*capi.Cluster, []client.Object) {
+	if len(annotationsKeyValues)%2 != 0 {
+		Fail("wrong number of arguments for newFakeCapaCluster. Expected even number of arguments for annotation key/value pairs")
+	}
+
+	annotations := map[string]string{}
+	for i := 0; i < len(annotationsKeyValues); i += 2 {
+		annotations[annotationsKeyValues[i]] = annotationsKeyValues[i+1]
+	}
+
+	cluster := &capi.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "acme",
+			Namespace:   "org-acme",
+			Annotations: annotations,
+		},
+		Spec: capi.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{Kind: "AWSCluster", Name: "acme"},
+		},
+	}
+	awsCluster := &capa.AWSCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "acme",
+			Namespace: "org-acme",
+		},
+		Spec: capa.AWSClusterSpec{
+			Region: "eu-west-1",
+			IdentityRef: &capa.AWSIdentityReference{
+				Name: "acme",
+				Kind: "AWSClusterRoleIdentity",
+			},
+			NetworkSpec: capa.NetworkSpec{
+				VPC: capa.VPCSpec{ID: "vpc-1"},
+			},
+		},
+		Status: capa.AWSClusterStatus{
+			Network: capa.NetworkStatus{
+				SecurityGroups: map[capa.SecurityGroupRole]capa.SecurityGroup{
+					capa.SecurityGroupControlPlane: {ID: "sg-cp"},
+					capa.SecurityGroupNode:         {ID: "sg-node"},
+				},
+			},
+		},
+	}
+	identity := &capa.AWSClusterRoleIdentity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "acme",
+			// The fake client does not ignore the namespace of cluster
+			// scoped objects
+			Namespace: "org-acme",
+		},
+		Spec: capa.AWSClusterRoleIdentitySpec{
+			AWSRoleSpec: capa.AWSRoleSpec{
+				RoleArn: "arn:aws:iam::123456789012:role/capa-controller",
+			},
+		},
+	}
+
+	return cluster, []client.Object{cluster, awsCluster, identity}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// managedCRDGroups returns the API groups of the crossplane objects the
+// operator creates once their CRDs are installed.
+func managedCRDGroups() map[string]bool {
+	groups := map[string]bool{
+		environmentConfigKind.Group: true,
+	}
+	for _, gk := range providerConfigKinds {
+		groups[gk.Group] = true
+	}
+	for _, gvk := range workloadProviderConfigGVKs {
+		groups[gvk.Group] = true
+	}
+
+	return groups
+}
+
+// crdPredicate lets through CRDs of the managed groups when they are created
+// or change. Clusters reconciled while the CRD was missing skipped the object,
+// so they need another reconcile once it is established. The CRDs are watched
+// by metadata only, which does not include the Established condition, so
+// every change is let through, the status update establishing the CRD
+// included. CRDs of the managed groups rarely change otherwise.
+func crdPredicate() predicate.Funcs {
+	groups := managedCRDGroups()
+	isRelevant := func(obj client.Object) bool {
+		// CRDs are named <plural>.<group>
+		_, group, _ := strings.Cut(obj.GetName(), ".")
+		return groups[group]
+	}
+
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return isRelevant(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isRelevant(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// requestsForAllClusters enqueues every cluster managed by the operator, e.g.
+// when a CRD is established or the operator config changed.
+func (r *ConfigMapReconciler) requestsForAllClusters(ctx context.Context, obj client.Object) []reconcile.Request {
+	logger := log.FromContext(ctx)
+
+	clusters := &capi.ClusterList{}
+	err := r.Client.List(ctx, clusters)
+	if err != nil {
+		logger.Error(err, "failed to list clusters")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(clusters.Items))
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if !r.Scope.Contains(cluster) || !isManagedCluster(cluster) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			},
+		})
+	}
+	logger.Info("Reconciling all clusters", "trigger", obj.GetName(), "clusters", len(requests))
+
+	return requests
+}
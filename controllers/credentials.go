@@ -0,0 +1,375 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// awsPartitions are the partitions a provider role can be in.
+var awsPartitions = []string{"aws", "aws-cn", "aws-us-gov"}
+
+var roleNamePattern = regexp.MustCompile(`^[\w+=,.@-]+$`)
+
+// CredentialsSource selects how the aws provider authenticates, i.e. the
+// shape of the credentials in the generated ProviderConfig.
+type CredentialsSource string
+
+const (
+	// CredentialsSourceWebIdentity assumes the provider role with the
+	// projected service account token of the provider pod.
+	CredentialsSourceWebIdentity CredentialsSource = "WebIdentity"
+	// CredentialsSourceIRSA uses the role from the eks.amazonaws.com/role-arn
+	// annotation of the provider ServiceAccount and assumes the provider role
+	// of the cluster account from there.
+	CredentialsSourceIRSA CredentialsSource = "IRSA"
+	// CredentialsSourcePodIdentity uses the role of the EKS Pod Identity
+	// association of the provider and assumes the provider role of the
+	// cluster account from there.
+	CredentialsSourcePodIdentity CredentialsSource = "PodIdentity"
+	// CredentialsSourceSecret reads static credentials from a Secret.
+	CredentialsSourceSecret CredentialsSource = "Secret"
+)
+
+const (
+	DefaultCredentialsSecretKey = "creds"
+
+	// CredentialsSourceAnnotation on the Cluster overrides the operator level
+	// credentials source.
+	CredentialsSourceAnnotation = "crossplane-config-operator.giantswarm.io/credentials-source"
+	// CredentialsSecretAnnotation on the Cluster overrides the operator level
+	// credentials secret, as `name` or `namespace/name`.
+	CredentialsSecretAnnotation = "crossplane-config-operator.giantswarm.io/credentials-secret"
+)
+
+var credentialsSources = []CredentialsSource{
+	CredentialsSourceWebIdentity,
+	CredentialsSourceIRSA,
+	CredentialsSourcePodIdentity,
+	CredentialsSourceSecret,
+}
+
+// ParseCredentialsSource parses a credentials source. An empty string
+// selects WebIdentity.
+func ParseCredentialsSource(s string) (CredentialsSource, error) {
+	if s == "" {
+		return CredentialsSourceWebIdentity, nil
+	}
+
+	for _, source := range credentialsSources {
+		if strings.EqualFold(s, string(source)) {
+			return source, nil
+		}
+	}
+
+	return "", errors.Errorf("unknown credentials source %q, must be one of %v", s, credentialsSources)
+}
+
+// ParseCredentialsSecret parses a secret reference in the form `name` or
+// `namespace/name`. A bare name refers to a secret in defaultNamespace.
+func ParseCredentialsSecret(s, defaultNamespace string) (types.NamespacedName, error) {
+	secret := types.NamespacedName{Namespace: defaultNamespace, Name: s}
+	if namespace, name, ok := strings.Cut(s, "/"); ok {
+		secret = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	if msgs := validation.IsDNS1123Subdomain(secret.Name); len(msgs) > 0 {
+		return types.NamespacedName{}, errors.Errorf("invalid credentials secret name %q: %s", secret.Name, strings.Join(msgs, ", "))
+	}
+	if msgs := validation.IsDNS1123Label(secret.Namespace); len(msgs) > 0 {
+		return types.NamespacedName{}, errors.Errorf("invalid credentials secret namespace %q: %s", secret.Namespace, strings.Join(msgs, ", "))
+	}
+
+	return secret, nil
+}
+
+func (r *ConfigMapReconciler) getCredentialsSource(cluster *capi.Cluster) (CredentialsSource, error) {
+	value, ok := cluster.Annotations[CredentialsSourceAnnotation]
+	if !ok {
+		if r.CredentialsSource == "" {
+			return CredentialsSourceWebIdentity, nil
+		}
+		return r.CredentialsSource, nil
+	}
+
+	source, err := ParseCredentialsSource(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid %s annotation", CredentialsSourceAnnotation)
+	}
+
+	return source, nil
+}
+
+// getCredentialsSecret returns the secret of the Secret credentials source.
+// The annotation can only name a secret in the namespace of the cluster, so
+// the owners of a cluster can not hand the provider the credentials of
+// another namespace.
+func (r *ConfigMapReconciler) getCredentialsSecret(cluster *capi.Cluster) (types.NamespacedName, error) {
+	if value, ok := cluster.Annotations[CredentialsSecretAnnotation]; ok && value != "" {
+		if strings.Contains(value, "/") {
+			return types.NamespacedName{}, errors.Errorf("invalid %s annotation %q, must be the name of a secret in the namespace of the cluster",
+				CredentialsSecretAnnotation, value)
+		}
+		secret, err := ParseCredentialsSecret(value, cluster.Namespace)
+		if err != nil {
+			return types.NamespacedName{}, errors.Wrapf(err, "invalid %s annotation", CredentialsSecretAnnotation)
+		}
+		return secret, nil
+	}
+
+	value := r.CredentialsSecret
+	if value == "" {
+		return types.NamespacedName{}, errors.Errorf("credentials source %s needs a secret, set it with --credentials-secret or the %s annotation",
+			CredentialsSourceSecret, CredentialsSecretAnnotation)
+	}
+
+	secret, err := ParseCredentialsSecret(value, cluster.Namespace)
+	if err != nil {
+		return types.NamespacedName{}, errors.WithStack(err)
+	}
+
+	return secret, nil
+}
+
+// roleTemplateData is the data the provider role template is rendered with.
+type roleTemplateData struct {
+	Partition   string
+	AccountID   string
+	ClusterName string
+	Namespace   string
+	Region      string
+}
+
+func getRoleTemplateData(cluster *capi.Cluster, accountID, region string) roleTemplateData {
+	return roleTemplateData{
+		Partition:   getPartition(region),
+		AccountID:   accountID,
+		ClusterName: cluster.Name,
+		Namespace:   cluster.Namespace,
+		Region:      region,
+	}
+}
+
+// renderRoleARN renders a provider role template. It is a Go template for
+// either a full role ARN or a role name, optionally with a path. Role names
+// are turned into an ARN in the cluster account, which keeps the bare role
+// names of earlier versions working.
+func renderRoleARN(text string, data roleTemplateData) (string, error) {
+	role, err := executeRoleTemplate(text, data)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	roleARN, err := parseRoleARN(role)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	// A role of another partition can never be assumed from the cluster
+	if roleARN.Partition != data.Partition {
+		return "", errors.Errorf("invalid provider role %q, its partition %q does not match the partition %q of the cluster, use {{ .Partition }}",
+			role, roleARN.Partition, data.Partition)
+	}
+
+	return role, nil
+}
+
+func executeRoleTemplate(text string, data roleTemplateData) (string, error) {
+	tmpl, err := template.New("provider role").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse provider role template")
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to render provider role template")
+	}
+
+	role := strings.TrimSpace(out.String())
+	if !strings.HasPrefix(role, "arn:") {
+		role = fmt.Sprintf("arn:%s:iam::%s:role/%s", data.Partition, data.AccountID, strings.TrimPrefix(role, "/"))
+	}
+
+	return role, nil
+}
+
+// parseRoleARN checks the syntax of an IAM role ARN, including the role name
+// and path.
+func parseRoleARN(role string) (arn.ARN, error) {
+	roleARN, err := arn.Parse(role)
+	if err != nil {
+		return arn.ARN{}, errors.Wrapf(err, "invalid provider role %q", role)
+	}
+	if roleARN.Service != "iam" || !strings.HasPrefix(roleARN.Resource, "role/") || roleARN.Resource == "role/" {
+		return arn.ARN{}, errors.Errorf("invalid provider role %q, must be an IAM role ARN", role)
+	}
+	if !slices.Contains(awsPartitions, roleARN.Partition) {
+		return arn.ARN{}, errors.Errorf("invalid provider role %q, unknown partition %q, must be one of %v", role, roleARN.Partition, awsPartitions)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(roleARN.Resource, "role/"), "/")
+	name := segments[len(segments)-1]
+	if len(name) > 64 || !roleNamePattern.MatchString(name) {
+		return arn.ARN{}, errors.Errorf("invalid provider role %q, the role name %q must be 1 to 64 letters, digits or +=,.@_- characters", role, name)
+	}
+	for _, segment := range segments[:len(segments)-1] {
+		if segment == "" || strings.ContainsAny(segment, " \t\n") {
+			return arn.ARN{}, errors.Errorf("invalid provider role %q, the role path must not contain empty segments or whitespace", role)
+		}
+	}
+
+	return roleARN, nil
+}
+
+// roleTemplateSample is the cluster a provider role template is rendered for
+// when the configuration is validated.
+var roleTemplateSample = roleTemplateData{
+	Partition:   "aws",
+	AccountID:   "123456789012",
+	ClusterName: "example",
+	Namespace:   "org-example",
+	Region:      "eu-west-1",
+}
+
+// validateRoleTemplate renders a provider role template for a sample cluster
+// to catch syntax errors before any cluster is reconciled. Roles with a fixed
+// partition or account are checked as well. The partition of the sample
+// cluster is not enforced, so fixed ARNs of other partitions stay valid.
+func validateRoleTemplate(text string) error {
+	role, err := executeRoleTemplate(text, roleTemplateSample)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	roleARN, err := parseRoleARN(role)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !accountIDPattern.MatchString(roleARN.AccountID) {
+		return errors.Errorf("invalid provider role %q, the account ID %q must be 12 digits", role, roleARN.AccountID)
+	}
+
+	return nil
+}
+
+// providerCredentials are the resolved credentials of the ProviderConfig of
+// a cluster.
+type providerCredentials struct {
+	Source CredentialsSource
+	// RoleARN is the role the provider assumes, unset for the Secret source.
+	RoleARN string
+	// Secret and SecretKey are only set for the Secret source.
+	Secret    types.NamespacedName
+	SecretKey string
+	// AssumeRoleChain are roles assumed after authenticating, see
+	// provider_config_variants.go.
+	AssumeRoleChain []string
+}
+
+// resolveCredentials combines the operator configuration and the annotations
+// of the cluster into the credentials of its ProviderConfig.
+func (r *ConfigMapReconciler) resolveCredentials(cluster *capi.Cluster, accountID, region string) (providerCredentials, error) {
+	source, err := r.getCredentialsSource(cluster)
+	if err != nil {
+		return providerCredentials{}, errors.WithStack(err)
+	}
+
+	if source == CredentialsSourceSecret {
+		secret, err := r.getCredentialsSecret(cluster)
+		if err != nil {
+			return providerCredentials{}, errors.WithStack(err)
+		}
+
+		return providerCredentials{
+			Source:    source,
+			Secret:    secret,
+			SecretKey: templateOrDefault(r.CredentialsSecretKey, DefaultCredentialsSecretKey),
+		}, nil
+	}
+
+	roleARN, err := renderRoleARN(templateOrDefault(cluster.Annotations[ProviderRoleAnnotation], r.ProviderRole), getRoleTemplateData(cluster, accountID, region))
+	if err != nil {
+		return providerCredentials{}, errors.WithStack(err)
+	}
+
+	return providerCredentials{
+		Source:  source,
+		RoleARN: roleARN,
+	}, nil
+}
+
+// getProviderConfigSpec renders the ProviderConfig spec for the credentials.
+// namespace is the namespace of namespaced ProviderConfigs, and empty for
+// cluster scoped ones. Namespaced ProviderConfigs can only reference secrets
+// in their own namespace, a secret in another namespace is an error instead
+// of silently being looked up in the namespace of the ProviderConfig.
+func getProviderConfigSpec(credentials providerCredentials, namespace string) (map[string]interface{}, error) {
+	spec := map[string]interface{}{}
+	assumeRoleChain := credentials.AssumeRoleChain
+
+	switch credentials.Source {
+	case CredentialsSourceSecret:
+		if namespace != "" && credentials.Secret.Namespace != namespace {
+			return nil, errors.Errorf("credentials secret %s is not in namespace %s, namespaced ProviderConfigs can only reference secrets in their own namespace, use a secret name without namespace",
+				credentials.Secret, namespace)
+		}
+
+		spec["credentials"] = map[string]interface{}{
+			"source": string(credentials.Source),
+			"secretRef": map[string]interface{}{
+				"namespace": credentials.Secret.Namespace,
+				"name":      credentials.Secret.Name,
+				"key":       credentials.SecretKey,
+			},
+		}
+	case CredentialsSourceIRSA, CredentialsSourcePodIdentity:
+		spec["credentials"] = map[string]interface{}{
+			"source": string(credentials.Source),
+		}
+		assumeRoleChain = append([]string{credentials.RoleARN}, assumeRoleChain...)
+	default:
+		spec["credentials"] = map[string]interface{}{
+			"source": string(CredentialsSourceWebIdentity),
+			"webIdentity": map[string]interface{}{
+				"roleARN": credentials.RoleARN,
+			},
+		}
+	}
+
+	if len(assumeRoleChain) > 0 {
+		chain := []interface{}{}
+		for _, roleARN := range assumeRoleChain {
+			chain = append(chain, map[string]interface{}{
+				"roleARN": roleARN,
+			})
+		}
+		spec["assumeRoleChain"] = chain
+	}
+
+	return spec, nil
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler credentials", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		annotations []string
+		region      string
+		kinds       map[schema.GroupVersionKind]meta.RESTScope
+		fakeClient  client.Client
+		reconciler  *controllers.ConfigMapReconciler
+		cluster     *capi.Cluster
+	)
+
+	const roleARN = "arn:aws:iam::123456789012:role/the-provider-role"
+
+	getProviderConfig := func() (*unstructured.Unstructured, error) {
+		providerConfig := &unstructured.Unstructured{}
+		providerConfig.SetAPIVersion("aws.upbound.io/v1beta1")
+		providerConfig.SetKind("ProviderConfig")
+		err := fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, providerConfig)
+		return providerConfig, err
+	}
+
+	getSpec := func() map[string]interface{} {
+		providerConfig, err := getProviderConfig()
+		Expect(err).NotTo(HaveOccurred())
+		spec, _, err := unstructured.NestedMap(providerConfig.Object, "spec")
+		Expect(err).NotTo(HaveOccurred())
+		return spec
+	}
+
+	getCluster := func() *capi.Cluster {
+		current := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+		return current
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		annotations = nil
+		region = ""
+		kinds = fakeCrossplaneKinds
+		reconciler = &controllers.ConfigMapReconciler{
+			BaseDomain:   "base.domain.io",
+			ProviderRole: "the-provider-role",
+		}
+	})
+
+	JustBeforeEach(func() {
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster(annotations...)
+		if region != "" {
+			objects[1].(*capa.AWSCluster).Spec.Region = region
+		}
+		fakeClient = newFakeManagementClientWithKinds(kinds, objects...)
+		reconciler.Client = fakeClient
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("uses the provider role as web identity by default", func() {
+		Expect(getSpec()).To(MatchAllKeys(Keys{
+			"credentials": MatchAllKeys(Keys{
+				"source": Equal("WebIdentity"),
+				"webIdentity": MatchAllKeys(Keys{
+					"roleARN": Equal(roleARN),
+				}),
+			}),
+		}))
+	})
+
+	When("the cluster is in GovCloud", func() {
+		BeforeEach(func() {
+			region = "us-gov-west-1"
+		})
+
+		It("uses the GovCloud partition", func() {
+			Expect(getSpec()).To(MatchAllKeys(Keys{
+				"credentials": MatchAllKeys(Keys{
+					"source": Equal("WebIdentity"),
+					"webIdentity": MatchAllKeys(Keys{
+						"roleARN": Equal("arn:aws-us-gov:iam::123456789012:role/the-provider-role"),
+					}),
+				}),
+			}))
+		})
+	})
+
+	When("the source is IRSA", func() {
+		BeforeEach(func() {
+			reconciler.CredentialsSource = controllers.CredentialsSourceIRSA
+		})
+
+		It("assumes the provider role from the role of the provider", func() {
+			Expect(getSpec()).To(MatchAllKeys(Keys{
+				"credentials": MatchAllKeys(Keys{
+					"source": Equal("IRSA"),
+				}),
+				"assumeRoleChain": ConsistOf(MatchAllKeys(Keys{
+					"roleARN": Equal(roleARN),
+				})),
+			}))
+		})
+	})
+
+	When("the source is PodIdentity", func() {
+		BeforeEach(func() {
+			reconciler.CredentialsSource = controllers.CredentialsSourcePodIdentity
+		})
+
+		It("assumes the provider role from the role of the provider", func() {
+			Expect(getSpec()).To(MatchAllKeys(Keys{
+				"credentials": MatchAllKeys(Keys{
+					"source": Equal("PodIdentity"),
+				}),
+				"assumeRoleChain": ConsistOf(MatchAllKeys(Keys{
+					"roleARN": Equal(roleARN),
+				})),
+			}))
+		})
+	})
+
+	When("the source is Secret", func() {
+		BeforeEach(func() {
+			reconciler.CredentialsSource = controllers.CredentialsSourceSecret
+			reconciler.CredentialsSecret = "crossplane/aws-creds"
+		})
+
+		It("references the secret of the operator", func() {
+			Expect(getSpec()).To(MatchAllKeys(Keys{
+				"credentials": MatchAllKeys(Keys{
+					"source": Equal("Secret"),
+					"secretRef": MatchAllKeys(Keys{
+						"namespace": Equal("crossplane"),
+						"name":      Equal("aws-creds"),
+						"key":       Equal(controllers.DefaultCredentialsSecretKey),
+					}),
+				}),
+			}))
+		})
+
+		When("the cluster names a secret", func() {
+			BeforeEach(func() {
+				annotations = []string{controllers.CredentialsSecretAnnotation, "cluster-creds"}
+			})
+
+			It("references the secret in the namespace of the cluster", func() {
+				Expect(getSpec()).To(HaveKeyWithValue("credentials", HaveKeyWithValue("secretRef", MatchAllKeys(Keys{
+					"namespace": Equal("org-acme"),
+					"name":      Equal("cluster-creds"),
+					"key":       Equal(controllers.DefaultCredentialsSecretKey),
+				}))))
+			})
+		})
+
+		When("the cluster names a secret in another namespace", func() {
+			BeforeEach(func() {
+				annotations = []string{controllers.CredentialsSecretAnnotation, "crossplane/aws-creds"}
+			})
+
+			It("does not create the provider config", func() {
+				_, err := getProviderConfig()
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("reports invalid credentials", func() {
+				cluster := getCluster()
+				Expect(conditions.IsFalse(cluster, controllers.ProviderConfigReadyCondition)).To(BeTrue())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+				Expect(conditions.GetMessage(cluster, controllers.ProviderConfigReadyCondition)).To(ContainSubstring("namespace of the cluster"))
+			})
+		})
+
+		When("the provider config is namespaced", func() {
+			getNamespacedProviderConfig := func() (*unstructured.Unstructured, error) {
+				providerConfig := &unstructured.Unstructured{}
+				providerConfig.SetAPIVersion("aws.m.upbound.io/v1beta1")
+				providerConfig.SetKind("ProviderConfig")
+				err := fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, providerConfig)
+				return providerConfig, err
+			}
+
+			BeforeEach(func() {
+				kinds = map[schema.GroupVersionKind]meta.RESTScope{
+					{Group: "aws.m.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}:               meta.RESTScopeNamespace,
+					{Group: "apiextensions.crossplane.io", Version: "v1beta1", Kind: "EnvironmentConfig"}: meta.RESTScopeRoot,
+				}
+				var err error
+				reconciler.ProviderConfigKind, reconciler.ProviderConfigVersion, err = controllers.ParseProviderConfigAPI("ProviderConfig.aws.m.upbound.io")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("does not create the provider config", func() {
+				_, err := getNamespacedProviderConfig()
+				Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("reports the secret in another namespace", func() {
+				cluster := getCluster()
+				Expect(conditions.IsFalse(cluster, controllers.ProviderConfigReadyCondition)).To(BeTrue())
+				Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+				Expect(conditions.GetMessage(cluster, controllers.ProviderConfigReadyCondition)).To(ContainSubstring("crossplane/aws-creds"))
+			})
+
+			When("the secret has no namespace", func() {
+				BeforeEach(func() {
+					reconciler.CredentialsSecret = "aws-creds"
+				})
+
+				It("references the secret in its own namespace", func() {
+					providerConfig, err := getNamespacedProviderConfig()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(providerConfig.Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("credentials", HaveKeyWithValue("secretRef", MatchAllKeys(Keys{
+						"namespace": Equal("org-acme"),
+						"name":      Equal("aws-creds"),
+						"key":       Equal(controllers.DefaultCredentialsSecretKey),
+					})))))
+				})
+			})
+		})
+	})
+
+	When("the cluster selects the source", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.CredentialsSourceAnnotation, "irsa"}
+		})
+
+		It("uses the source of the cluster", func() {
+			Expect(getSpec()).To(HaveKeyWithValue("credentials", HaveKeyWithValue("source", "IRSA")))
+		})
+	})
+
+	When("the cluster selects an unknown source", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.CredentialsSourceAnnotation, "InjectedIdentity"}
+		})
+
+		It("reports invalid credentials", func() {
+			Expect(conditions.GetReason(getCluster(), controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidCredentialsReason))
+		})
+
+		It("still creates the configmap", func() {
+			Expect(conditions.IsTrue(getCluster(), controllers.ConfigMapReadyCondition)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,409 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DryRunPendingChangeReason is the reason of the events on a Cluster listing
+// the changes a dry run did not write.
+const DryRunPendingChangeReason = "DryRunPendingChange"
+
+// pendingChanges counts the writes a dry run skipped in the last reconcile of
+// each cluster.
+var pendingChanges = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "pending_changes",
+		Help: "Number of objects the last dry run reconcile of a cluster would have created, changed or deleted.",
+	},
+	[]string{"namespace", "cluster"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(pendingChanges)
+}
+
+// fieldChange is a difference between the live and the desired object.
+type fieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// ignoredMetadataFields are set by the API server and never written by the
+// operator.
+var ignoredMetadataFields = []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields", "selfLink"}
+
+// pendingChange is a write the dry run client did not send.
+type pendingChange struct {
+	// Verb is create, update, patch, delete or delete all of, with a status
+	// suffix for status writes.
+	Verb   string
+	Status bool
+	Kind   string
+	// Object is the namespace/name of the object.
+	Object  string
+	Changes []fieldChange
+}
+
+// dryRunReport collects the pending changes of one reconcile.
+type dryRunReport struct {
+	cluster types.NamespacedName
+
+	lock    sync.Mutex
+	changes []pendingChange
+	// reported are the changed fields so far by kind, object and path, so a
+	// field written twice, e.g. a finalizer added and then patched again with
+	// the conditions, is reported once.
+	reported map[string]bool
+}
+
+type dryRunReportKey struct{}
+
+// startDryRunReport attaches a report for the cluster to the context. The
+// dry run client adds the skipped writes to it.
+func startDryRunReport(ctx context.Context, cluster types.NamespacedName) (context.Context, *dryRunReport) {
+	report := &dryRunReport{cluster: cluster}
+	return context.WithValue(ctx, dryRunReportKey{}, report), report
+}
+
+func getDryRunReport(ctx context.Context) *dryRunReport {
+	report, _ := ctx.Value(dryRunReportKey{}).(*dryRunReport)
+	return report
+}
+
+// add adds the change without the fields reported before and returns it.
+// Changes without new fields are dropped.
+func (r *dryRunReport) add(change pendingChange) pendingChange {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.reported == nil {
+		r.reported = map[string]bool{}
+	}
+	changes := []fieldChange{}
+	for _, field := range change.Changes {
+		key := strings.Join([]string{change.Kind, change.Object, field.Path}, " ")
+		if r.reported[key] {
+			continue
+		}
+		r.reported[key] = true
+		changes = append(changes, field)
+	}
+	change.Changes = changes
+
+	if len(changes) > 0 {
+		r.changes = append(r.changes, change)
+	}
+	return change
+}
+
+func (r *dryRunReport) getChanges() []pendingChange {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.changes)
+}
+
+// publish exposes the pending changes of the reconcile. Clusters without
+// pending changes are removed from the metric.
+func (r *dryRunReport) publish() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.changes) == 0 {
+		pendingChanges.DeleteLabelValues(r.cluster.Namespace, r.cluster.Name)
+		return
+	}
+	pendingChanges.WithLabelValues(r.cluster.Namespace, r.cluster.Name).Set(float64(len(r.changes)))
+}
+
+// dryRunClient replaces the client of the reconciler with --dry-run. Reads go
+// to the cluster. Writes are diffed against the live objects, logged and
+// reported as events on the Cluster instead of being sent.
+type dryRunClient struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+// NewDryRunClient wraps c so it only reports writes. SetupWithManager wraps
+// the client of a reconciler with DryRun set.
+func NewDryRunClient(c client.Client, recorder record.EventRecorder) client.Client {
+	if _, ok := c.(*dryRunClient); ok {
+		return c
+	}
+	return &dryRunClient{Client: c, recorder: recorder}
+}
+
+func (c *dryRunClient) Create(ctx context.Context, obj client.Object, _ ...client.CreateOption) error {
+	return c.report(ctx, "create", nil, obj, false)
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj client.Object, _ ...client.UpdateOption) error {
+	return c.reportChange(ctx, "update", obj, false)
+}
+
+func (c *dryRunClient) Patch(ctx context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	return c.reportChange(ctx, "patch", obj, false)
+}
+
+func (c *dryRunClient) Delete(ctx context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	return c.report(ctx, "delete", obj, nil, false)
+}
+
+func (c *dryRunClient) DeleteAllOf(ctx context.Context, obj client.Object, _ ...client.DeleteAllOfOption) error {
+	return c.report(ctx, "delete all of", obj, nil, false)
+}
+
+func (c *dryRunClient) Status() client.SubResourceWriter {
+	return &dryRunStatusWriter{client: c}
+}
+
+type dryRunStatusWriter struct {
+	client *dryRunClient
+}
+
+func (w *dryRunStatusWriter) Create(ctx context.Context, obj client.Object, _ client.Object, _ ...client.SubResourceCreateOption) error {
+	return w.client.reportChange(ctx, "create status", obj, true)
+}
+
+func (w *dryRunStatusWriter) Update(ctx context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	return w.client.reportChange(ctx, "update status", obj, true)
+}
+
+func (w *dryRunStatusWriter) Patch(ctx context.Context, obj client.Object, _ client.Patch, _ ...client.SubResourcePatchOption) error {
+	return w.client.reportChange(ctx, "patch status", obj, true)
+}
+
+// reportChange diffs obj against the live object. The live object is read
+// into a new object, a client decoding into a copy of obj would merge maps and
+// hide removed fields.
+func (c *dryRunClient) reportChange(ctx context.Context, verb string, obj client.Object, status bool) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var live client.Object
+	if _, ok := obj.(runtime.Unstructured); ok {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		live = u
+	} else {
+		newObj, err := c.Scheme().New(gvk)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		var ok bool
+		live, ok = newObj.(client.Object)
+		if !ok {
+			return errors.Errorf("unexpected object %T", newObj)
+		}
+	}
+
+	err = c.Client.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return c.report(ctx, verb, live, obj, status)
+}
+
+// report logs the changes from live to desired, either of which may be nil,
+// emits an event on the cluster of the reconcile and counts the change.
+// Writes without any change are ignored.
+func (c *dryRunClient) report(ctx context.Context, verb string, live, desired client.Object, status bool) error {
+	logger := log.FromContext(ctx)
+
+	obj := desired
+	if obj == nil {
+		obj = live
+	}
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	changes, err := diffObjects(live, desired, status)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	key := obj.GetName()
+	if obj.GetNamespace() != "" {
+		key = obj.GetNamespace() + "/" + key
+	}
+
+	report := getDryRunReport(ctx)
+	if report != nil {
+		changes = report.add(pendingChange{Verb: verb, Status: status, Kind: gvk.Kind, Object: key, Changes: changes}).Changes
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+	logger.Info("Dry run, not writing", "verb", verb, "kind", gvk.Kind, "object", key, "changes", changes)
+
+	if report == nil || c.recorder == nil {
+		return nil
+	}
+	cluster := &capi.Cluster{}
+	err = c.Client.Get(ctx, report.cluster, cluster)
+	if err != nil {
+		// The change is logged, the event is best effort
+		logger.Error(err, "failed to get cluster for dry run event")
+		return nil
+	}
+	message := fmt.Sprintf("Dry run: would %s %s %s", verb, gvk.Kind, key)
+	if live != nil && desired != nil {
+		paths := make([]string, 0, len(changes))
+		for _, change := range changes {
+			paths = append(paths, change.Path)
+		}
+		message += ", changing " + strings.Join(paths, ", ")
+	}
+	c.recorder.Event(cluster, corev1.EventTypeNormal, DryRunPendingChangeReason, message)
+
+	return nil
+}
+
+// diffObjects returns the changed fields from live to desired. Either may be
+// nil for a create or delete. Status writes only compare the status, all
+// other writes everything but the status.
+func diffObjects(live, desired client.Object, status bool) ([]fieldChange, error) {
+	liveContent, err := comparableContent(live, status)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	desiredContent, err := comparableContent(desired, status)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	changes := []fieldChange{}
+	diffValues("", liveContent, desiredContent, &changes)
+
+	return changes, nil
+}
+
+func comparableContent(obj client.Object, status bool) (map[string]interface{}, error) {
+	if obj == nil || reflect.ValueOf(obj).IsNil() {
+		return map[string]interface{}{}, nil
+	}
+
+	var content map[string]interface{}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		content = runtime.DeepCopyJSON(u.UnstructuredContent())
+	} else {
+		var err error
+		content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if status {
+		statusContent, _ := content["status"].(map[string]interface{})
+		return map[string]interface{}{"status": statusContent}, nil
+	}
+
+	delete(content, "status")
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range ignoredMetadataFields {
+			delete(metadata, field)
+		}
+	}
+
+	return content, nil
+}
+
+// diffValues appends the changes between two decoded JSON values, descending
+// into maps. Lists are compared as a whole.
+func diffValues(path string, old, new interface{}, changes *[]fieldChange) {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := []string{}
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			diffValues(joinFieldPath(path, key), oldMap[key], newMap[key], changes)
+		}
+		return
+	}
+
+	if isEmptyValue(old) && isEmptyValue(new) {
+		return
+	}
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	*changes = append(*changes, fieldChange{Path: path, Old: old, New: new})
+}
+
+func joinFieldPath(path, key string) string {
+	if strings.ContainsAny(key, "./") {
+		key = fmt.Sprintf("[%s]", key)
+	} else if path != "" {
+		key = "." + key
+	}
+	return path + key
+}
+
+// isEmptyValue treats missing and empty values alike, e.g. an empty label
+// map the API server drops.
+func isEmptyValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+// getPendingChanges returns the pending_changes metric of a cluster, or nil
+// when it is not exposed.
+func getPendingChanges(namespace, name string) *float64 {
+	families, err := metrics.Registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, family := range families {
+		if family.GetName() != "pending_changes" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["namespace"] == namespace && labels["cluster"] == name {
+				value := metric.GetGauge().GetValue()
+				return &value
+			}
+		}
+	}
+
+	return nil
+}
+
+var _ = Describe("Dry run", Label(unitLabel), func() {
+	var (
+		ctx        context.Context
+		fakeClient client.Client
+		recorder   *record.FakeRecorder
+		reconciler *controllers.ConfigMapReconciler
+		cluster    *capi.Cluster
+		request    ctrl.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		// A cluster that is no longer an AWS cluster only needs its
+		// finalizer removed, which keeps the fake client setup small.
+		cluster = &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "dry-run",
+				Namespace:  "org-test",
+				Finalizers: []string{controllers.Finalizer},
+			},
+			Spec: capi.ClusterSpec{
+				InfrastructureRef: &corev1.ObjectReference{Kind: "AzureCluster"},
+			},
+		}
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(capi.AddToScheme(scheme)).To(Succeed())
+		Expect(capa.AddToScheme(scheme)).To(Succeed())
+		fakeClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build()
+
+		recorder = record.NewFakeRecorder(10)
+		reconciler = &controllers.ConfigMapReconciler{
+			Client:   controllers.NewDryRunClient(fakeClient, recorder),
+			DryRun:   true,
+			Recorder: recorder,
+		}
+		request = ctrl.Request{NamespacedName: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}}
+	})
+
+	It("reports changes without writing them", func() {
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		live := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, request.NamespacedName, live)).To(Succeed())
+		Expect(live.Finalizers).To(ContainElement(controllers.Finalizer))
+
+		Expect(recorder.Events).To(Receive(And(
+			ContainSubstring(controllers.DryRunPendingChangeReason),
+			ContainSubstring("would patch Cluster org-test/dry-run, changing metadata.finalizers"),
+		)))
+		Expect(getPendingChanges("org-test", "dry-run")).To(HaveValue(BeEquivalentTo(1)))
+	})
+
+	It("clears the pending changes once nothing would change", func() {
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getPendingChanges("org-test", "dry-run")).NotTo(BeNil())
+
+		live := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, request.NamespacedName, live)).To(Succeed())
+		live.Finalizers = nil
+		Expect(fakeClient.Update(ctx, live)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getPendingChanges("org-test", "dry-run")).To(BeNil())
+	})
+
+	It("reports each changed field of an object once", func() {
+		dryRunClient := controllers.NewDryRunClient(fakeClient, recorder)
+		ctx := controllers.StartDryRunReport(ctx, request.NamespacedName)
+
+		live := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, request.NamespacedName, live)).To(Succeed())
+		desired := live.DeepCopy()
+		desired.Finalizers = nil
+		Expect(dryRunClient.Patch(ctx, desired, client.MergeFrom(live))).To(Succeed())
+		Expect(dryRunClient.Patch(ctx, desired, client.MergeFrom(live))).To(Succeed())
+		desired.Labels = map[string]string{"giantswarm.io/organization": "test"}
+		Expect(dryRunClient.Patch(ctx, desired, client.MergeFrom(live))).To(Succeed())
+
+		Expect(recorder.Events).To(Receive(HaveSuffix("changing metadata.finalizers")))
+		Expect(recorder.Events).To(Receive(HaveSuffix("changing metadata.labels")))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("ignores writes without changes", func() {
+		dryRunClient := controllers.NewDryRunClient(fakeClient, recorder)
+
+		live := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, request.NamespacedName, live)).To(Succeed())
+		Expect(dryRunClient.Patch(ctx, live.DeepCopy(), client.MergeFrom(live))).To(Succeed())
+		Expect(dryRunClient.Delete(ctx, live)).To(Succeed())
+
+		Expect(fakeClient.Get(ctx, request.NamespacedName, &capi.Cluster{})).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
+
+var _ = Describe("Dry run of an AWS cluster", Label(unitLabel), func() {
+	var (
+		ctx        context.Context
+		apiClient  client.Client
+		recorder   *record.FakeRecorder
+		reconciler *controllers.ConfigMapReconciler
+		cluster    *capi.Cluster
+	)
+
+	// getEvents returns the events recorded so far.
+	getEvents := func() []string {
+		events := []string{}
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster()
+		apiClient = newFakeManagementClient(objects...)
+
+		recorder = record.NewFakeRecorder(100)
+		reconciler = &controllers.ConfigMapReconciler{
+			BaseDomain:   "base.domain.io",
+			ProviderRole: "the-provider-role",
+			DryRun:       true,
+			Recorder:     recorder,
+		}
+	})
+
+	When("the client does not reset the object it reads into", func() {
+		var mergingClient client.Client
+
+		BeforeEach(func() {
+			// Like a client decoding into the existing maps and fields of obj
+			mergingClient = interceptor.NewClient(apiClient.(client.WithWatch), interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					live, ok := obj.DeepCopyObject().(client.Object)
+					Expect(ok).To(BeTrue())
+					err := c.Get(ctx, key, live, opts...)
+					if err != nil {
+						return err
+					}
+					data, err := json.Marshal(live)
+					Expect(err).NotTo(HaveOccurred())
+					return json.Unmarshal(data, obj)
+				},
+			})
+
+			// Generate the objects, then drop a finalizer, a label and a data
+			// key the operator writes
+			reconciler.Client = apiClient
+			reconciler.PropagateLabels = []string{"giantswarm.io/organization"}
+			reconciler.OutputFormats = []controllers.OutputFormat{"json"}
+			current := &capi.Cluster{}
+			Expect(apiClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+			current.Labels = map[string]string{"giantswarm.io/organization": "acme"}
+			Expect(apiClient.Update(ctx, current)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(apiClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+			current.Finalizers = nil
+			Expect(apiClient.Update(ctx, current)).To(Succeed())
+			configMap := &corev1.ConfigMap{}
+			Expect(apiClient.Get(ctx, types.NamespacedName{Name: "acme-crossplane-config", Namespace: "org-acme"}, configMap)).To(Succeed())
+			Expect(configMap.Data).To(HaveKey("values.json"))
+			delete(configMap.Labels, "giantswarm.io/organization")
+			delete(configMap.Data, "values.json")
+			Expect(apiClient.Update(ctx, configMap)).To(Succeed())
+			getEvents()
+		})
+
+		It("reports the fields missing from the live objects", func() {
+			reconciler.Client = controllers.NewDryRunClient(mergingClient, recorder)
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(getEvents()).To(ContainElements(
+				ContainSubstring("would patch Cluster org-acme/acme, changing metadata.finalizers"),
+				And(
+					MatchRegexp("would (update|patch) ConfigMap org-acme/acme-crossplane-config"),
+					ContainSubstring("data[values.json]"),
+					ContainSubstring("metadata.labels[giantswarm.io/organization]"),
+				),
+			))
+		})
+	})
+})
@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EKSClusterInfoResolver resolves clusters backed by an
+// AWSManagedControlPlane with the same name.
+type EKSClusterInfoResolver struct {
+	Client client.Client
+}
+
+func (r *EKSClusterInfoResolver) Resolve(ctx context.Context, cluster *capi.Cluster) (*ClusterInfo, error) {
+	awsManagedControlPlane := &eks.AWSManagedControlPlane{}
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(cluster), awsManagedControlPlane)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	clusterInfo := &ClusterInfo{
+		AWSManagedControlPlane: awsManagedControlPlane,
+		Name:                   awsManagedControlPlane.Name,
+		Namespace:              awsManagedControlPlane.Namespace,
+		Region:                 awsManagedControlPlane.Spec.Region,
+		AWSPartition:           getPartition(awsManagedControlPlane.Spec.Region),
+		VpcID:                  awsManagedControlPlane.Spec.NetworkSpec.VPC.ID,
+	}
+
+	clusterInfo.RoleArn, err = getIdentityRoleARN(ctx, r.Client, awsManagedControlPlane.Spec.IdentityRef, awsManagedControlPlane.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cluster role identity")
+	}
+
+	// The endpoint is only known once the EKS cluster is created
+	clusterInfo.OIDCDomains = []string{}
+	if host := awsManagedControlPlane.Spec.ControlPlaneEndpoint.Host; host != "" {
+		eksId, err := getEKSId(host)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get EKS Cluster ID")
+		}
+		if eksId != "" {
+			clusterInfo.OIDCDomain = getEKSOIDCDomain(clusterInfo.Region, eksId)
+			clusterInfo.OIDCDomains = []string{clusterInfo.OIDCDomain}
+		}
+	}
+
+	clusterInfo.Missing = getMissingFields(map[string]bool{
+		VpcIDField:      clusterInfo.VpcID != "",
+		OIDCDomainField: clusterInfo.OIDCDomain != "",
+	})
+
+	return clusterInfo, nil
+}
@@ -54,7 +54,12 @@ var _ = Describe("ConfigMapReconcilerEKS", func() {
                 - oidc.eks.the-region.amazonaws.com/id/eks123clusterID
                 region: the-region
                 awsPartition: aws
-            `, accountID, cluster.Name, cluster.Name))))
+                ready: true
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, accountID))))
 	}
 
 	verifyProviderConfig := func() {
@@ -140,6 +145,9 @@ var _ = Describe("ConfigMapReconcilerEKS", func() {
 				ObjectMeta: metav1.ObjectMeta{
 					Namespace: cluster.Namespace,
 					Name:      fmt.Sprintf("%s-crossplane-config", cluster.Name),
+					Labels: map[string]string{
+						controllers.ManagedByLabel: controllers.ManagedByValue,
+					},
 				},
 			}
 			configMap.Data = map[string]string{
@@ -164,6 +172,9 @@ var _ = Describe("ConfigMapReconcilerEKS", func() {
 				"metadata": map[string]interface{}{
 					"name":      cluster.Name,
 					"namespace": cluster.Namespace,
+					"labels": map[string]interface{}{
+						controllers.ManagedByLabel: controllers.ManagedByValue,
+					},
 				},
 				"spec": map[string]interface{}{
 					"credentials": map[string]interface{}{
@@ -262,7 +273,12 @@ var _ = Describe("ConfigMapReconcilerEKS", func() {
                 clusterName: %s
                 region: cn-north-1
                 awsPartition: aws-cn
-            `, accountID, cluster.Name, cluster.Name))))
+                ready: true
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws-cn:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, accountID))))
 		})
 
 		It("creates the provider config with the correct aws partition", func() {
@@ -326,7 +342,12 @@ var _ = Describe("ConfigMapReconcilerEKS", func() {
                 - oidc.eks.the-region.amazonaws.com/id/eks123clusterID
                 clusterName: %s
                 region: the-region
-            `, accountID, cluster.Name, cluster.Name))))
+                ready: true
+                providerConfig:
+                  credentialsSource: WebIdentity
+                  name: %s
+                  roleARN: arn:aws:iam::%s:role/the-provider-role
+            `, accountID, cluster.Name, cluster.Name, cluster.Name, accountID))))
 		})
 	})
 
@@ -0,0 +1,164 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+// EndpointAnnotation on the Cluster replaces the operator level endpoint
+// override. The value is a YAML or JSON endpoint config, `{}` removes the
+// override for the cluster.
+const EndpointAnnotation = "crossplane-config-operator.giantswarm.io/endpoint"
+
+// EndpointConfig overrides the AWS endpoint of the generated ProviderConfigs,
+// e.g. for VPC interface endpoints or LocalStack. provider-aws supports a
+// single endpoint URL per ProviderConfig.
+type EndpointConfig struct {
+	// URL is the endpoint URL used instead of the AWS endpoints.
+	URL string `json:"url"`
+	// Services limits the override to the given services, e.g. `sts` or
+	// `s3`. It applies to all services when empty.
+	Services []string `json:"services,omitempty"`
+	// HostnameImmutable stops the SDK from changing the hostname, e.g. by
+	// prefixing the bucket name for S3.
+	HostnameImmutable *bool `json:"hostnameImmutable,omitempty"`
+	// SigningRegion is the region requests to the endpoint are signed for.
+	// It applies to all services of the override, there is no separate
+	// region for STS.
+	SigningRegion string `json:"signingRegion,omitempty"`
+}
+
+// UnmarshalJSON rejects several endpoint URLs with a clear error, as
+// provider-aws only supports one URL per ProviderConfig. Unknown fields are
+// rejected as well.
+func (e *EndpointConfig) UnmarshalJSON(data []byte) error {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if value := bytes.TrimSpace(raw["url"]); len(value) > 0 && (value[0] == '[' || value[0] == '{') {
+		return errors.New("endpoint url must be a single URL, provider-aws supports one endpoint per ProviderConfig, use services to limit it to some services")
+	}
+	if value := bytes.TrimSpace(raw["services"]); len(value) > 0 && value[0] == '{' {
+		return errors.New("endpoint services must be a list of service names, provider-aws does not support an endpoint url per service")
+	}
+
+	type endpointConfig EndpointConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode((*endpointConfig)(e))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// ParseEndpointConfig parses a YAML or JSON endpoint config. An empty string
+// or an empty object disables the override.
+func ParseEndpointConfig(s string) (*EndpointConfig, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	endpoint := &EndpointConfig{}
+	err := yaml.UnmarshalStrict([]byte(s), endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse endpoint config")
+	}
+
+	return validateEndpointConfig(endpoint)
+}
+
+// validateEndpointConfig checks an endpoint override, e.g. from the operator
+// config file. An empty override is returned as nil.
+func validateEndpointConfig(endpoint *EndpointConfig) (*EndpointConfig, error) {
+	if endpoint == nil {
+		return nil, nil
+	}
+	if endpoint.URL == "" && len(endpoint.Services) == 0 && endpoint.HostnameImmutable == nil && endpoint.SigningRegion == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint url %q", endpoint.URL)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf("invalid endpoint url %q, must be an absolute http or https URL", endpoint.URL)
+	}
+	for _, service := range endpoint.Services {
+		if service == "" || strings.ToLower(service) != service {
+			return nil, errors.Errorf("invalid endpoint service %q, must be a lower case service name", service)
+		}
+	}
+
+	return endpoint, nil
+}
+
+func (r *ConfigMapReconciler) getEndpointConfig(cluster *capi.Cluster) (*EndpointConfig, error) {
+	value, ok := cluster.Annotations[EndpointAnnotation]
+	if !ok {
+		return r.Endpoint, nil
+	}
+
+	endpoint, err := ParseEndpointConfig(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s annotation", EndpointAnnotation)
+	}
+
+	return endpoint, nil
+}
+
+// setEndpoint adds the endpoint override to a rendered ProviderConfig spec.
+func setEndpoint(spec map[string]interface{}, endpoint *EndpointConfig) {
+	if endpoint == nil {
+		return
+	}
+
+	config := map[string]interface{}{
+		"source": "Custom",
+		"url": map[string]interface{}{
+			"type":   "Static",
+			"static": endpoint.URL,
+		},
+	}
+	if len(endpoint.Services) > 0 {
+		services := []interface{}{}
+		for _, service := range endpoint.Services {
+			services = append(services, service)
+		}
+		config["services"] = services
+	}
+	if endpoint.HostnameImmutable != nil {
+		config["hostnameImmutable"] = *endpoint.HostnameImmutable
+	}
+	if endpoint.SigningRegion != "" {
+		config["signingRegion"] = endpoint.SigningRegion
+	}
+
+	spec["endpoint"] = config
+}
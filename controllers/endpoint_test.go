@@ -0,0 +1,170 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler endpoint", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		annotations []string
+		fakeClient  client.Client
+		reconciler  *controllers.ConfigMapReconciler
+		cluster     *capi.Cluster
+	)
+
+	getSpec := func() map[string]interface{} {
+		providerConfig := &unstructured.Unstructured{}
+		providerConfig.SetAPIVersion("aws.upbound.io/v1beta1")
+		providerConfig.SetKind("ProviderConfig")
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, providerConfig)).To(Succeed())
+		spec, _, err := unstructured.NestedMap(providerConfig.Object, "spec")
+		Expect(err).NotTo(HaveOccurred())
+		return spec
+	}
+
+	getCluster := func() *capi.Cluster {
+		current := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+		return current
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		annotations = nil
+
+		hostnameImmutable := true
+		reconciler = &controllers.ConfigMapReconciler{
+			BaseDomain:   "base.domain.io",
+			ProviderRole: "the-provider-role",
+			Endpoint: &controllers.EndpointConfig{
+				URL:               "http://localstack.localstack.svc:4566",
+				Services:          []string{"sts", "s3"},
+				HostnameImmutable: &hostnameImmutable,
+				SigningRegion:     "us-east-1",
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster(annotations...)
+		fakeClient = newFakeManagementClient(objects...)
+		reconciler.Client = fakeClient
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("adds the endpoint of the operator to the provider config", func() {
+		Expect(getSpec()).To(HaveKeyWithValue("endpoint", MatchAllKeys(Keys{
+			"source": Equal("Custom"),
+			"url": MatchAllKeys(Keys{
+				"type":   Equal("Static"),
+				"static": Equal("http://localstack.localstack.svc:4566"),
+			}),
+			"services":          ConsistOf("sts", "s3"),
+			"hostnameImmutable": BeTrue(),
+			"signingRegion":     Equal("us-east-1"),
+		})))
+		// The credentials are unchanged
+		Expect(getSpec()).To(HaveKeyWithValue("credentials", HaveKeyWithValue("source", "WebIdentity")))
+	})
+
+	It("adds the endpoint url to the values", func() {
+		configMap := &corev1.ConfigMap{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)).To(Succeed())
+		Expect(configMap.Data).To(HaveKeyWithValue("values", ContainSubstring("endpoint: http://localstack.localstack.svc:4566")))
+	})
+
+	When("the cluster sets its own endpoint", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.EndpointAnnotation, `{"url": "https://vpce-1.sts.eu-west-1.vpce.amazonaws.com", "services": ["sts"]}`}
+		})
+
+		It("uses the endpoint of the cluster", func() {
+			Expect(getSpec()).To(HaveKeyWithValue("endpoint", MatchAllKeys(Keys{
+				"source":   Equal("Custom"),
+				"url":      HaveKeyWithValue("static", "https://vpce-1.sts.eu-west-1.vpce.amazonaws.com"),
+				"services": ConsistOf("sts"),
+			})))
+		})
+	})
+
+	When("the cluster removes the endpoint", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.EndpointAnnotation, "{}"}
+		})
+
+		It("uses the AWS endpoints", func() {
+			Expect(getSpec()).NotTo(HaveKey("endpoint"))
+		})
+	})
+
+	When("there is no endpoint", func() {
+		BeforeEach(func() {
+			reconciler.Endpoint = nil
+		})
+
+		It("uses the AWS endpoints", func() {
+			Expect(getSpec()).NotTo(HaveKey("endpoint"))
+		})
+	})
+
+	DescribeTable("rejects invalid endpoints of the cluster",
+		func(value, message string) {
+			annotations = []string{controllers.EndpointAnnotation, value}
+			// Reconcile the annotated cluster
+			var objects []client.Object
+			cluster, objects = newFakeCapaCluster(annotations...)
+			fakeClient = newFakeManagementClient(objects...)
+			reconciler.Client = fakeClient
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+			Expect(err).NotTo(HaveOccurred())
+
+			cluster := getCluster()
+			Expect(conditions.GetReason(cluster, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.InvalidAnnotationReason))
+			Expect(conditions.GetMessage(cluster, controllers.ProviderConfigReadyCondition)).To(ContainSubstring(message))
+		},
+		Entry("relative url", `{"url": "localstack:4566"}`, "must be an absolute http or https URL"),
+		Entry("several urls", `{"url": ["http://sts.local", "http://s3.local"]}`, "must be a single URL"),
+		Entry("a url per service", `{"url": "http://sts.local", "services": {"sts": "http://sts.local"}}`, "does not support an endpoint url per service"),
+		Entry("unknown fields", `{"url": "https://example.com", "region": "eu-west-1"}`, "unknown field"),
+	)
+
+	It("rejects several urls in the operator config", func() {
+		_, err := controllers.ParseOperatorConfig([]byte("apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1\nkind: OperatorConfig\n" +
+			"providerRole: crossplane\nbaseDomain: base.domain.io\nproviderConfig:\n  endpoint:\n    url: [http://sts.local, http://s3.local]\n"))
+		Expect(err).To(MatchError(ContainSubstring("must be a single URL")))
+	})
+})
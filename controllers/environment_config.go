@@ -0,0 +1,170 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Standard labels of the generated objects, so compositions can select
+	// them, e.g. with environment config selectors.
+	AccountIDLabel = "crossplane-config-operator.giantswarm.io/account-id"
+	RegionLabel    = "crossplane-config-operator.giantswarm.io/region"
+)
+
+// environmentConfigKind is the EnvironmentConfig kind of Crossplane. Its
+// version is the preferred one served by the management cluster, as it
+// differs between Crossplane releases.
+var environmentConfigKind = schema.GroupKind{
+	Group: "apiextensions.crossplane.io",
+	Kind:  "EnvironmentConfig",
+}
+
+// getEnvironmentConfigGVK returns the EnvironmentConfig kind in the version
+// served by mapper. It fails with a NoMatch error when Crossplane is not
+// installed.
+func getEnvironmentConfigGVK(mapper metaerr.RESTMapper) (schema.GroupVersionKind, error) {
+	mapping, err := mapper.RESTMapping(environmentConfigKind)
+	if err != nil {
+		return schema.GroupVersionKind{}, errors.WithStack(err)
+	}
+
+	return mapping.GroupVersionKind, nil
+}
+
+func getEnvironmentConfig(gvk schema.GroupVersionKind, name string) *unstructured.Unstructured {
+	environmentConfig := &unstructured.Unstructured{}
+	environmentConfig.Object = map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+	}
+	environmentConfig.SetGroupVersionKind(gvk)
+
+	return environmentConfig
+}
+
+func (r *ConfigMapReconciler) reconcileEnvironmentConfig(ctx context.Context, cluster *capi.Cluster, clusterInfo *ClusterInfo, name string, accountID, baseDomain string) error {
+	logger := log.FromContext(ctx)
+
+	data, err := getEnvironmentConfigData(clusterInfo, accountID, baseDomain)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	gvk, err := getEnvironmentConfigGVK(r.Client.RESTMapper())
+	if metaerr.IsNoMatchError(err) {
+		logger.Info("Environment config CRD not found, skipping environment config creation")
+		conditions.MarkFalse(cluster, EnvironmentConfigReadyCondition, EnvironmentConfigAPIUnavailableReason, capi.ConditionSeverityInfo,
+			"The EnvironmentConfig API is not served, install Crossplane to create it")
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "Failed to discover environment config api")
+		return errors.WithStack(err)
+	}
+
+	environmentConfig := getEnvironmentConfig(gvk, name)
+	err = r.Client.Get(ctx, types.NamespacedName{
+		Name: name,
+	}, environmentConfig)
+	if k8serrors.IsNotFound(err) {
+		logger.Info("Creating environment config")
+		setEnvironmentConfigLabels(environmentConfig, clusterInfo)
+		environmentConfig.Object["data"] = data
+
+		err = r.Client.Create(ctx, environmentConfig)
+		if err != nil {
+			logger.Error(err, "failed to create environment config")
+			return errors.WithStack(err)
+		}
+		conditions.MarkTrue(cluster, EnvironmentConfigReadyCondition)
+		return r.deleteManagedObjects(ctx, gvk, cluster, name)
+	}
+	if err != nil {
+		logger.Error(err, "failed to get environment config")
+		return errors.WithStack(err)
+	}
+
+	if !isManaged(environmentConfig) && !isAdoptable(environmentConfig) {
+		logger.Info("environment config is not managed by the operator, refusing to update it")
+		conditions.MarkFalse(cluster, EnvironmentConfigReadyCondition, OwnershipConflictReason, capi.ConditionSeverityWarning,
+			"EnvironmentConfig %s is not managed by %s, annotate it with %s=true to adopt it",
+			environmentConfig.GetName(), ManagedByValue, AdoptAnnotation)
+		return nil
+	}
+
+	patched := environmentConfig.DeepCopy()
+	setEnvironmentConfigLabels(patched, clusterInfo)
+	patched.Object["data"] = data
+	err = r.Client.Patch(ctx, patched, client.MergeFrom(environmentConfig))
+	if err != nil {
+		logger.Error(err, "failed to patch environment config")
+		return errors.WithStack(err)
+	}
+	conditions.MarkTrue(cluster, EnvironmentConfigReadyCondition)
+
+	return r.deleteManagedObjects(ctx, gvk, cluster, name)
+}
+
+// deleteEnvironmentConfigs deletes the EnvironmentConfigs of the cluster
+// except the ones in keep.
+func (r *ConfigMapReconciler) deleteEnvironmentConfigs(ctx context.Context, cluster *capi.Cluster, keep ...string) error {
+	gvk, err := getEnvironmentConfigGVK(r.Client.RESTMapper())
+	if metaerr.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return r.deleteManagedObjects(ctx, gvk, cluster, keep...)
+}
+
+// setEnvironmentConfigLabels labels the environment config with its cluster.
+// The account ID and region labels are part of the propagated metadata.
+func setEnvironmentConfigLabels(environmentConfig *unstructured.Unstructured, clusterInfo *ClusterInfo) {
+	setManaged(environmentConfig)
+	setClusterLabels(environmentConfig, clusterInfo.Name, clusterInfo.Namespace)
+	setPropagatedMetadata(environmentConfig, clusterInfo.Metadata)
+}
+
+// getEnvironmentConfigData returns the built-in values in the shape of the
+// EnvironmentConfig `data` field.
+func getEnvironmentConfigData(clusterInfo *ClusterInfo, accountID, baseDomain string) (map[string]interface{}, error) {
+	values := getCrossplaneConfigValues(clusterInfo, accountID, baseDomain)
+
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&values)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler environment config", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		kinds      map[schema.GroupVersionKind]meta.RESTScope
+		fakeClient client.Client
+		cluster    *capi.Cluster
+	)
+
+	getCluster := func() *capi.Cluster {
+		current := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+		return current
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		kinds = fakeCrossplaneKinds
+	})
+
+	JustBeforeEach(func() {
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster()
+		fakeClient = newFakeManagementClientWithKinds(kinds, objects...)
+		reconciler := &controllers.ConfigMapReconciler{
+			Client:       fakeClient,
+			BaseDomain:   "base.domain.io",
+			ProviderRole: "the-provider-role",
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("labels the environment config with the account and region", func() {
+		environmentConfig := &unstructured.Unstructured{}
+		environmentConfig.SetAPIVersion("apiextensions.crossplane.io/v1beta1")
+		environmentConfig.SetKind("EnvironmentConfig")
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, environmentConfig)).To(Succeed())
+
+		Expect(environmentConfig.GetLabels()).To(MatchKeys(IgnoreExtras, Keys{
+			controllers.ManagedByLabel:        Equal(controllers.ManagedByValue),
+			controllers.ClusterNameLabel:      Equal("acme"),
+			controllers.ClusterNamespaceLabel: Equal("org-acme"),
+			controllers.AccountIDLabel:        Equal("123456789012"),
+			controllers.RegionLabel:           Equal("eu-west-1"),
+		}))
+		Expect(conditions.IsTrue(getCluster(), controllers.EnvironmentConfigReadyCondition)).To(BeTrue())
+	})
+
+	When("Crossplane serves the EnvironmentConfig in another version", func() {
+		BeforeEach(func() {
+			kinds = map[schema.GroupVersionKind]meta.RESTScope{
+				{Group: "aws.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}:                  meta.RESTScopeRoot,
+				{Group: "apiextensions.crossplane.io", Version: "v1alpha1", Kind: "EnvironmentConfig"}: meta.RESTScopeRoot,
+			}
+		})
+
+		It("creates the environment config in the served version", func() {
+			environmentConfig := &unstructured.Unstructured{}
+			environmentConfig.SetAPIVersion("apiextensions.crossplane.io/v1alpha1")
+			environmentConfig.SetKind("EnvironmentConfig")
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, environmentConfig)).To(Succeed())
+			Expect(conditions.IsTrue(getCluster(), controllers.EnvironmentConfigReadyCondition)).To(BeTrue())
+		})
+	})
+
+	When("the EnvironmentConfig CRD is not installed", func() {
+		BeforeEach(func() {
+			kinds = map[schema.GroupVersionKind]meta.RESTScope{
+				{Group: "aws.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}: meta.RESTScopeRoot,
+			}
+		})
+
+		It("reports the missing API", func() {
+			cluster := getCluster()
+			Expect(conditions.IsFalse(cluster, controllers.EnvironmentConfigReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(cluster, controllers.EnvironmentConfigReadyCondition)).To(Equal(controllers.EnvironmentConfigAPIUnavailableReason))
+			Expect(conditions.IsTrue(cluster, controllers.ConfigMapReadyCondition)).To(BeTrue())
+		})
+	})
+})
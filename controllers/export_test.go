@@ -0,0 +1,37 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ConfigChangeSource exposes the config change watch of SetupWithManager to
+// the specs, which run without a manager.
+func (r *ConfigMapReconciler) ConfigChangeSource() source.Source {
+	return r.configChangeSource()
+}
+
+// StartDryRunReport exposes the report of a dry run reconcile to the specs
+// calling the dry run client directly.
+func StartDryRunReport(ctx context.Context, cluster types.NamespacedName) context.Context {
+	ctx, _ = startDryRunReport(ctx, cluster)
+	return ctx
+}
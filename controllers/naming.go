@@ -0,0 +1,165 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	DefaultConfigMapNameTemplate         = "{{ .ClusterName }}-crossplane-config"
+	DefaultConfigMapNamespaceTemplate    = "{{ .Namespace }}"
+	DefaultProviderConfigNameTemplate    = "{{ .ClusterName }}"
+	DefaultEnvironmentConfigNameTemplate = "{{ .ClusterName }}"
+
+	// Annotations on the Cluster overriding the operator level templates for a
+	// single cluster. The values are templates themselves.
+	ConfigMapNameAnnotation         = "crossplane-config-operator.giantswarm.io/config-map-name"
+	ConfigMapNamespaceAnnotation    = "crossplane-config-operator.giantswarm.io/config-map-namespace"
+	ProviderConfigNameAnnotation    = "crossplane-config-operator.giantswarm.io/provider-config-name"
+	EnvironmentConfigNameAnnotation = "crossplane-config-operator.giantswarm.io/environment-config-name"
+)
+
+// nameTemplateData is the data the name and namespace templates are rendered
+// with.
+type nameTemplateData struct {
+	ClusterName string
+	Namespace   string
+	Labels      map[string]string
+	AccountID   string
+}
+
+type objectNames struct {
+	ConfigMap         types.NamespacedName
+	ProviderConfig    string
+	EnvironmentConfig string
+}
+
+func (r *ConfigMapReconciler) getObjectNames(cluster *capi.Cluster, accountID string) (objectNames, error) {
+	data := nameTemplateData{
+		ClusterName: cluster.Name,
+		Namespace:   cluster.Namespace,
+		Labels:      cluster.Labels,
+		AccountID:   accountID,
+	}
+	if data.Labels == nil {
+		data.Labels = map[string]string{}
+	}
+
+	names := objectNames{}
+	var err error
+
+	names.ConfigMap.Name, err = renderNameTemplate(
+		"config map name",
+		templateOrDefault(cluster.Annotations[ConfigMapNameAnnotation], r.ConfigMapNameTemplate, DefaultConfigMapNameTemplate),
+		data,
+	)
+	if err != nil {
+		return objectNames{}, errors.WithStack(err)
+	}
+	if msgs := validation.IsDNS1123Subdomain(names.ConfigMap.Name); len(msgs) > 0 {
+		return objectNames{}, errors.Errorf("invalid config map name %q: %s", names.ConfigMap.Name, strings.Join(msgs, ", "))
+	}
+
+	names.ConfigMap.Namespace, err = renderNameTemplate(
+		"config map namespace",
+		templateOrDefault(cluster.Annotations[ConfigMapNamespaceAnnotation], r.ConfigMapNamespaceTemplate, DefaultConfigMapNamespaceTemplate),
+		data,
+	)
+	if err != nil {
+		return objectNames{}, errors.WithStack(err)
+	}
+	if msgs := validation.IsDNS1123Label(names.ConfigMap.Namespace); len(msgs) > 0 {
+		return objectNames{}, errors.Errorf("invalid config map namespace %q: %s", names.ConfigMap.Namespace, strings.Join(msgs, ", "))
+	}
+
+	names.ProviderConfig, err = renderNameTemplate(
+		"provider config name",
+		templateOrDefault(cluster.Annotations[ProviderConfigNameAnnotation], r.ProviderConfigNameTemplate, DefaultProviderConfigNameTemplate),
+		data,
+	)
+	if err != nil {
+		return objectNames{}, errors.WithStack(err)
+	}
+	if msgs := validation.IsDNS1123Subdomain(names.ProviderConfig); len(msgs) > 0 {
+		return objectNames{}, errors.Errorf("invalid provider config name %q: %s", names.ProviderConfig, strings.Join(msgs, ", "))
+	}
+
+	names.EnvironmentConfig, err = renderNameTemplate(
+		"environment config name",
+		templateOrDefault(cluster.Annotations[EnvironmentConfigNameAnnotation], r.EnvironmentConfigNameTemplate, DefaultEnvironmentConfigNameTemplate),
+		data,
+	)
+	if err != nil {
+		return objectNames{}, errors.WithStack(err)
+	}
+	if msgs := validation.IsDNS1123Subdomain(names.EnvironmentConfig); len(msgs) > 0 {
+		return objectNames{}, errors.Errorf("invalid environment config name %q: %s", names.EnvironmentConfig, strings.Join(msgs, ", "))
+	}
+
+	return names, nil
+}
+
+// checkConfigMapNamespace rejects a config map namespace selected with the
+// annotation of the cluster outside of the namespace of the cluster and the
+// allowed namespaces. Otherwise anyone allowed to annotate a Cluster could
+// have the operator write config maps into any namespace, e.g. kube-system.
+// The operator level template is trusted.
+func (r *ConfigMapReconciler) checkConfigMapNamespace(cluster *capi.Cluster, namespace string) error {
+	if cluster.Annotations[ConfigMapNamespaceAnnotation] == "" {
+		return nil
+	}
+	if namespace == cluster.Namespace || slices.Contains(r.ConfigMapAllowedNamespaces, namespace) {
+		return nil
+	}
+
+	return errors.Errorf("config map namespace %q of the %s annotation is neither the namespace of the cluster nor one of the allowed namespaces %v",
+		namespace, ConfigMapNamespaceAnnotation, r.ConfigMapAllowedNamespaces)
+}
+
+// templateOrDefault returns the first non empty template.
+func templateOrDefault(templates ...string) string {
+	for _, t := range templates {
+		if t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+func renderNameTemplate(name, text string, data nameTemplateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse %s template", name)
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to render %s template", name)
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
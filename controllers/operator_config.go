@@ -0,0 +1,393 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OperatorConfigAPIVersion = "crossplane-config-operator.giantswarm.io/v1alpha1"
+	OperatorConfigKind       = "OperatorConfig"
+)
+
+// OperatorConfigSchema is the JSON schema of the operator config file. The
+// Helm chart uses the same definitions for the values written to the file.
+//
+//go:embed operator_config.schema.json
+var OperatorConfigSchema []byte
+
+var operatorConfigValidator = sync.OnceValues(func() (*validate.SchemaValidator, error) {
+	s := &spec.Schema{}
+	err := json.Unmarshal(OperatorConfigSchema, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse operator config schema")
+	}
+	return validate.NewSchemaValidator(s, nil, "", strfmt.Default), nil
+})
+
+// OperatorConfig is the versioned configuration file of the operator, set
+// with --config. It replaces the flags of the same settings. Empty values use
+// the operator defaults, like the flags do.
+//
+//	apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1
+//	kind: OperatorConfig
+//	providerRole: crossplane
+//	baseDomain: example.com
+type OperatorConfig struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// ProviderRole is a role template like --provider-role.
+	ProviderRole string `json:"providerRole,omitempty"`
+	BaseDomain   string `json:"baseDomain,omitempty"`
+
+	ConfigMap         ConfigMapSettings         `json:"configMap,omitempty"`
+	ProviderConfig    ProviderConfigSettings    `json:"providerConfig,omitempty"`
+	EnvironmentConfig EnvironmentConfigSettings `json:"environmentConfig,omitempty"`
+	Propagation       PropagationSettings       `json:"propagation,omitempty"`
+
+	// OutputFormats are the additional config map formats, see
+	// output_formats.go.
+	OutputFormats []string `json:"outputFormats,omitempty"`
+	// ValuesTemplatesDir is read again whenever the config is applied.
+	ValuesTemplatesDir string `json:"valuesTemplatesDir,omitempty"`
+}
+
+type ConfigMapSettings struct {
+	NameTemplate      string `json:"nameTemplate,omitempty"`
+	NamespaceTemplate string `json:"namespaceTemplate,omitempty"`
+	// AllowedNamespaces are the namespaces besides the one of the cluster
+	// the config-map-namespace annotation of a cluster may select.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+type ProviderConfigSettings struct {
+	NameTemplate string `json:"nameTemplate,omitempty"`
+	// API is the ProviderConfig kind like --provider-config-api.
+	API                  string                  `json:"api,omitempty"`
+	CredentialsSource    string                  `json:"credentialsSource,omitempty"`
+	CredentialsSecret    string                  `json:"credentialsSecret,omitempty"`
+	CredentialsSecretKey string                  `json:"credentialsSecretKey,omitempty"`
+	Variants             []ProviderConfigVariant `json:"variants,omitempty"`
+	Shared               string                  `json:"shared,omitempty"`
+	Endpoint             *EndpointConfig         `json:"endpoint,omitempty"`
+}
+
+type EnvironmentConfigSettings struct {
+	NameTemplate string `json:"nameTemplate,omitempty"`
+}
+
+type PropagationSettings struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// operatorSettings are the parsed settings of an OperatorConfig, as used by
+// the reconciler.
+type operatorSettings struct {
+	providerRole                  string
+	baseDomain                    string
+	providerConfigKind            schema.GroupKind
+	providerConfigVersion         string
+	credentialsSource             CredentialsSource
+	credentialsSecret             string
+	credentialsSecretKey          string
+	providerConfigVariants        []ProviderConfigVariant
+	sharedProviderConfig          SharedProviderConfigMode
+	endpoint                      *EndpointConfig
+	propagateLabels               []string
+	propagateAnnotations          []string
+	configMapNameTemplate         string
+	configMapNamespaceTemplate    string
+	configMapAllowedNamespaces    []string
+	providerConfigNameTemplate    string
+	environmentConfigNameTemplate string
+	valuesTemplates               map[string]*template.Template
+	outputFormats                 []OutputFormat
+}
+
+// LoadOperatorConfig reads and validates the operator config file.
+func LoadOperatorConfig(path string) (OperatorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return OperatorConfig{}, errors.WithStack(err)
+	}
+
+	config, err := ParseOperatorConfig(data)
+	if err != nil {
+		return OperatorConfig{}, errors.Wrapf(err, "invalid operator config %s", path)
+	}
+
+	return config, nil
+}
+
+// ParseOperatorConfig parses and validates an operator config. Unknown fields
+// are rejected, so typos do not silently fall back to defaults.
+func ParseOperatorConfig(data []byte) (OperatorConfig, error) {
+	config := OperatorConfig{}
+	err := yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return OperatorConfig{}, errors.Wrap(err, "failed to parse operator config")
+	}
+
+	if config.APIVersion != OperatorConfigAPIVersion || config.Kind != OperatorConfigKind {
+		return OperatorConfig{}, errors.Errorf("unsupported operator config %s %s, must be %s %s",
+			config.APIVersion, config.Kind, OperatorConfigAPIVersion, OperatorConfigKind)
+	}
+
+	err = validateOperatorConfigSchema(data)
+	if err != nil {
+		return OperatorConfig{}, errors.WithStack(err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return OperatorConfig{}, errors.WithStack(err)
+	}
+
+	return config, nil
+}
+
+// validateOperatorConfigSchema checks the operator config document against
+// OperatorConfigSchema, e.g. the allowed values of enumerations.
+func validateOperatorConfigSchema(data []byte) error {
+	validator, err := operatorConfigValidator()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var document interface{}
+	err = yaml.Unmarshal(data, &document)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse operator config")
+	}
+
+	result := validator.Validate(document)
+	if result.IsValid() {
+		return nil
+	}
+	msgs := []string{}
+	for _, err := range result.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	sort.Strings(msgs)
+	return errors.Errorf("operator config does not match the schema: %s", strings.Join(msgs, ", "))
+}
+
+// Validate checks the settings the same way as the flags, without applying
+// them.
+func (c OperatorConfig) Validate() error {
+	_, err := c.settings()
+	return errors.WithStack(err)
+}
+
+func (c OperatorConfig) settings() (operatorSettings, error) {
+	s := operatorSettings{
+		providerRole:                  c.ProviderRole,
+		baseDomain:                    c.BaseDomain,
+		credentialsSecret:             c.ProviderConfig.CredentialsSecret,
+		credentialsSecretKey:          c.ProviderConfig.CredentialsSecretKey,
+		configMapNameTemplate:         c.ConfigMap.NameTemplate,
+		configMapNamespaceTemplate:    c.ConfigMap.NamespaceTemplate,
+		providerConfigNameTemplate:    c.ProviderConfig.NameTemplate,
+		environmentConfigNameTemplate: c.EnvironmentConfig.NameTemplate,
+	}
+
+	var err error
+	s.credentialsSource, err = ParseCredentialsSource(c.ProviderConfig.CredentialsSource)
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid credentials source")
+	}
+
+	// Static credentials need no role, all other sources assume it
+	if s.credentialsSource == CredentialsSourceSecret {
+		if c.ProviderConfig.CredentialsSecret == "" {
+			return operatorSettings{}, errors.New("providerConfig.credentialsSecret (--credentials-secret) is required for the Secret credentials source, as name or namespace/name")
+		}
+		_, err = ParseCredentialsSecret(c.ProviderConfig.CredentialsSecret, "default")
+		if err != nil {
+			return operatorSettings{}, errors.Wrap(err, "invalid providerConfig.credentialsSecret (--credentials-secret)")
+		}
+	} else if c.ProviderRole == "" {
+		return operatorSettings{}, errors.New("providerRole (--provider-role) is required, " +
+			"a role name like crossplane or an ARN template like arn:{{ .Partition }}:iam::{{ .AccountID }}:role/crossplane")
+	}
+	if c.ProviderRole != "" {
+		err = validateRoleTemplate(c.ProviderRole)
+		if err != nil {
+			return operatorSettings{}, errors.Wrap(err, "invalid providerRole (--provider-role)")
+		}
+	}
+
+	if c.BaseDomain == "" {
+		return operatorSettings{}, errors.New("baseDomain (--base-domain) is required, the base domain of the management cluster like example.com")
+	}
+	if msgs := validation.IsDNS1123Subdomain(c.BaseDomain); len(msgs) > 0 {
+		return operatorSettings{}, errors.Errorf("invalid baseDomain (--base-domain) %q, must be a lower case DNS name like example.com: %s",
+			c.BaseDomain, strings.Join(msgs, ", "))
+	}
+
+	for _, namespace := range c.ConfigMap.AllowedNamespaces {
+		if namespace == "" {
+			continue
+		}
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			return operatorSettings{}, errors.Errorf("invalid configMap.allowedNamespaces (--config-map-allowed-namespaces) %q: %s",
+				namespace, strings.Join(msgs, ", "))
+		}
+		s.configMapAllowedNamespaces = append(s.configMapAllowedNamespaces, namespace)
+	}
+
+	s.outputFormats, err = ParseOutputFormats(strings.Join(c.OutputFormats, ","))
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid output formats")
+	}
+
+	s.providerConfigKind, s.providerConfigVersion, err = ParseProviderConfigAPI(c.ProviderConfig.API)
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid provider config api")
+	}
+
+	err = validateProviderConfigVariants(c.ProviderConfig.Variants)
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid provider config variants")
+	}
+	for _, variant := range c.ProviderConfig.Variants {
+		for _, role := range append([]string{variant.Role}, variant.AssumeRoleChain...) {
+			if role == "" {
+				continue
+			}
+			err = validateRoleTemplate(role)
+			if err != nil {
+				return operatorSettings{}, errors.Wrapf(err, "invalid role of provider config variant %q", variant.Suffix)
+			}
+		}
+	}
+	s.providerConfigVariants = c.ProviderConfig.Variants
+
+	s.sharedProviderConfig, err = ParseSharedProviderConfigMode(c.ProviderConfig.Shared)
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid shared provider config mode")
+	}
+	// The shared ProviderConfig of an account is rendered without a cluster
+	if s.sharedProviderConfig != SharedProviderConfigDisabled {
+		if s.credentialsSource == CredentialsSourceSecret && !strings.Contains(c.ProviderConfig.CredentialsSecret, "/") {
+			return operatorSettings{}, errors.Errorf("providerConfig.credentialsSecret (--credentials-secret) %q must be given as namespace/name for the shared provider config",
+				c.ProviderConfig.CredentialsSecret)
+		}
+		if s.credentialsSource != CredentialsSourceSecret {
+			err = validateSharedRoleTemplate(c.ProviderRole)
+			if err != nil {
+				return operatorSettings{}, errors.Wrap(err, "invalid providerRole (--provider-role)")
+			}
+		}
+	}
+
+	s.endpoint, err = validateEndpointConfig(c.ProviderConfig.Endpoint)
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid endpoint config")
+	}
+
+	s.propagateLabels, err = ParsePropagationPatterns(strings.Join(c.Propagation.Labels, ","))
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid label propagation patterns")
+	}
+
+	s.propagateAnnotations, err = ParsePropagationPatterns(strings.Join(c.Propagation.Annotations, ","))
+	if err != nil {
+		return operatorSettings{}, errors.Wrap(err, "invalid annotation propagation patterns")
+	}
+
+	if c.ValuesTemplatesDir != "" {
+		s.valuesTemplates, err = LoadValuesTemplates(c.ValuesTemplatesDir)
+		if err != nil {
+			return operatorSettings{}, errors.Wrap(err, "unable to load values templates")
+		}
+	}
+
+	return s, nil
+}
+
+// ApplyOperatorConfig validates the config and replaces the settings of the
+// reconciler. Once the controller runs, all clusters are reconciled again with
+// the new settings. On error the previous settings are kept.
+func (r *ConfigMapReconciler) ApplyOperatorConfig(config OperatorConfig) error {
+	s, err := config.settings()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = r.Scope.CheckConfigMapSettings(config.ConfigMap)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	r.settingsLock.Lock()
+	r.ProviderRole = s.providerRole
+	r.BaseDomain = s.baseDomain
+	r.ProviderConfigKind = s.providerConfigKind
+	r.ProviderConfigVersion = s.providerConfigVersion
+	r.CredentialsSource = s.credentialsSource
+	r.CredentialsSecret = s.credentialsSecret
+	r.CredentialsSecretKey = s.credentialsSecretKey
+	r.ProviderConfigVariants = s.providerConfigVariants
+	r.SharedProviderConfig = s.sharedProviderConfig
+	r.Endpoint = s.endpoint
+	r.PropagateLabels = s.propagateLabels
+	r.PropagateAnnotations = s.propagateAnnotations
+	r.ConfigMapNameTemplate = s.configMapNameTemplate
+	r.ConfigMapNamespaceTemplate = s.configMapNamespaceTemplate
+	r.ConfigMapAllowedNamespaces = s.configMapAllowedNamespaces
+	r.ProviderConfigNameTemplate = s.providerConfigNameTemplate
+	r.EnvironmentConfigNameTemplate = s.environmentConfigNameTemplate
+	r.ValuesTemplates = s.valuesTemplates
+	r.OutputFormats = s.outputFormats
+	r.settingsLock.Unlock()
+
+	r.notifyConfigChanged()
+
+	return nil
+}
+
+// notifyConfigChanged enqueues all clusters once the controller runs. The
+// channel holds at most one pending notification, further changes before it
+// is handled are covered by the same reconciles.
+func (r *ConfigMapReconciler) notifyConfigChanged() {
+	if r.configChanges == nil {
+		return
+	}
+
+	select {
+	case r.configChanges <- event.GenericEvent{Object: operatorConfigObject()}:
+	default:
+	}
+}
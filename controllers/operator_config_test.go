@@ -0,0 +1,308 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+const operatorConfigYAML = `apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1
+kind: OperatorConfig
+providerRole: crossplane
+baseDomain: base.domain.io
+configMap:
+  nameTemplate: "{{ .ClusterName }}-config"
+providerConfig:
+  api: ClusterProviderConfig.aws.m.upbound.io
+  credentialsSource: IRSA
+  variants:
+    - suffix: readonly
+      role: crossplane-readonly
+  shared: Alongside
+  endpoint:
+    url: http://localstack:4566
+propagation:
+  labels:
+    - giantswarm.io/organization
+outputFormats:
+  - json
+`
+
+var _ = Describe("OperatorConfig", Label(unitLabel), func() {
+	It("parses a config", func() {
+		config, err := controllers.ParseOperatorConfig([]byte(operatorConfigYAML))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.ProviderRole).To(Equal("crossplane"))
+		Expect(config.ConfigMap.NameTemplate).To(Equal("{{ .ClusterName }}-config"))
+		Expect(config.ProviderConfig.Variants).To(HaveLen(1))
+		Expect(config.ProviderConfig.Endpoint.URL).To(Equal("http://localstack:4566"))
+	})
+
+	It("rejects unknown fields", func() {
+		_, err := controllers.ParseOperatorConfig([]byte(operatorConfigYAML + "providerRol: typo\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects other versions", func() {
+		_, err := controllers.ParseOperatorConfig([]byte("apiVersion: crossplane-config-operator.giantswarm.io/v2\nkind: OperatorConfig\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects invalid settings", func() {
+		_, err := controllers.ParseOperatorConfig([]byte(operatorConfigYAML + "providerConfig:\n  shared: Sometimes\n"))
+		Expect(err).To(HaveOccurred())
+
+		config := controllers.OperatorConfig{OutputFormats: []string{"xml"}}
+		Expect(config.Validate()).To(HaveOccurred())
+	})
+
+	DescribeTable("rejects documents not matching the schema",
+		func(yaml string) {
+			_, err := controllers.ParseOperatorConfig([]byte("apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1\nkind: OperatorConfig\n" +
+				"providerRole: crossplane\nbaseDomain: base.domain.io\n" + yaml))
+			Expect(err).To(MatchError(ContainSubstring("does not match the schema")))
+		},
+		Entry("unknown output format", "outputFormats:\n  - yaml\n"),
+		Entry("unknown shared mode", "providerConfig:\n  shared: Sometimes\n"),
+		Entry("variant without suffix", "providerConfig:\n  variants:\n    - role: crossplane-readonly\n"),
+	)
+
+	It("shares the schema with the chart", func() {
+		operatorSchema := map[string]interface{}{}
+		Expect(json.Unmarshal(controllers.OperatorConfigSchema, &operatorSchema)).To(Succeed())
+		chartSchema := map[string]interface{}{}
+		data, err := os.ReadFile("../helm/aws-crossplane-cluster-config-operator/values.schema.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(data, &chartSchema)).To(Succeed())
+
+		chartProperties := chartSchema["properties"].(map[string]interface{})
+		for key, property := range operatorSchema["properties"].(map[string]interface{}) {
+			// Set by the chart template, not by values
+			if key == "apiVersion" || key == "kind" || key == "valuesTemplatesDir" {
+				continue
+			}
+			Expect(chartProperties).To(HaveKeyWithValue(key, property), key)
+		}
+	})
+
+	It("applies the settings to the reconciler", func() {
+		config, err := controllers.ParseOperatorConfig([]byte(operatorConfigYAML))
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciler := &controllers.ConfigMapReconciler{}
+		Expect(reconciler.ApplyOperatorConfig(config)).To(Succeed())
+		Expect(reconciler.ProviderRole).To(Equal("crossplane"))
+		Expect(reconciler.BaseDomain).To(Equal("base.domain.io"))
+		Expect(reconciler.ProviderConfigKind.Kind).To(Equal("ClusterProviderConfig"))
+		Expect(reconciler.CredentialsSource).To(Equal(controllers.CredentialsSourceIRSA))
+		Expect(reconciler.SharedProviderConfig).To(Equal(controllers.SharedProviderConfigAlongside))
+		Expect(reconciler.PropagateLabels).To(Equal([]string{"giantswarm.io/organization"}))
+		Expect(reconciler.OutputFormats).To(Equal([]controllers.OutputFormat{controllers.OutputFormatJSON}))
+	})
+
+	DescribeTable("rejects invalid required settings",
+		func(yaml string) {
+			_, err := controllers.ParseOperatorConfig([]byte("apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1\nkind: OperatorConfig\n" + yaml))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("missing provider role", "baseDomain: base.domain.io\n"),
+		Entry("missing base domain", "providerRole: crossplane\n"),
+		Entry("base domain not in DNS format", "providerRole: crossplane\nbaseDomain: Base_Domain.io.\n"),
+		Entry("invalid role name", "providerRole: cross plane\nbaseDomain: base.domain.io\n"),
+		Entry("invalid role template", "providerRole: \"{{ .Cluster }}\"\nbaseDomain: base.domain.io\n"),
+		Entry("no IAM role ARN", "providerRole: arn:aws:s3:::bucket\nbaseDomain: base.domain.io\n"),
+		Entry("unknown partition", "providerRole: arn:aws-eu:iam::123456789012:role/crossplane\nbaseDomain: base.domain.io\n"),
+		Entry("invalid account", "providerRole: arn:aws:iam::1234:role/crossplane\nbaseDomain: base.domain.io\n"),
+		Entry("invalid variant role", "providerRole: crossplane\nbaseDomain: base.domain.io\nproviderConfig:\n  variants:\n    - suffix: ro\n      role: \"a b\"\n"),
+		Entry("missing credentials secret", "baseDomain: base.domain.io\nproviderConfig:\n  credentialsSource: Secret\n"),
+		Entry("shared role using the cluster", "providerRole: \"crossplane-{{ .ClusterName }}\"\nbaseDomain: base.domain.io\nproviderConfig:\n  shared: Alongside\n"),
+		Entry("shared role using the region in a condition", "providerRole: \"{{ if eq $.Region \\\"cn-north-1\\\" }}china{{ else }}crossplane{{ end }}\"\nbaseDomain: base.domain.io\nproviderConfig:\n  shared: Instead\n"),
+		Entry("propagated label with a wildcard in the middle", "providerRole: crossplane\nbaseDomain: base.domain.io\npropagation:\n  labels:\n    - release.*/version\n"),
+		Entry("invalid propagated annotation", "providerRole: crossplane\nbaseDomain: base.domain.io\npropagation:\n  annotations:\n    - not a key\n"),
+		Entry("shared credentials secret without namespace", "baseDomain: base.domain.io\nproviderConfig:\n  credentialsSource: Secret\n  credentialsSecret: aws-creds\n  shared: Alongside\n"),
+	)
+
+	DescribeTable("accepts valid provider roles",
+		func(role string) {
+			config := controllers.OperatorConfig{ProviderRole: role, BaseDomain: "base.domain.io"}
+			Expect(config.Validate()).To(Succeed())
+		},
+		Entry("role name", "crossplane"),
+		Entry("role name with path", "crossplane/{{ .Namespace }}/{{ .ClusterName }}"),
+		Entry("ARN template", "arn:{{ .Partition }}:iam::{{ .AccountID }}:role/crossplane"),
+		Entry("ARN in another partition", "arn:aws-cn:iam::123456789012:role/crossplane"),
+	)
+
+	It("accepts shared role templates using the account", func() {
+		config := controllers.OperatorConfig{
+			ProviderRole: "arn:{{ .Partition }}:iam::{{ .AccountID }}:role/crossplane",
+			BaseDomain:   "base.domain.io",
+			ProviderConfig: controllers.ProviderConfigSettings{
+				Shared: "Alongside",
+			},
+		}
+		Expect(config.Validate()).To(Succeed())
+	})
+
+	It("does not require a provider role for static credentials", func() {
+		config := controllers.OperatorConfig{
+			BaseDomain: "base.domain.io",
+			ProviderConfig: controllers.ProviderConfigSettings{
+				CredentialsSource: "Secret",
+				CredentialsSecret: "crossplane/aws-creds",
+			},
+		}
+		Expect(config.Validate()).To(Succeed())
+	})
+
+	It("keeps the previous settings on error", func() {
+		reconciler := &controllers.ConfigMapReconciler{ProviderRole: "previous"}
+		config := controllers.OperatorConfig{ProviderRole: "next", OutputFormats: []string{"xml"}}
+		Expect(reconciler.ApplyOperatorConfig(config)).NotTo(Succeed())
+		Expect(reconciler.ProviderRole).To(Equal("previous"))
+	})
+
+	It("rejects config maps outside the namespaces of the scope", func() {
+		scope, err := controllers.ParseClusterScope("org-a", "")
+		Expect(err).NotTo(HaveOccurred())
+		reconciler := &controllers.ConfigMapReconciler{Scope: scope, ProviderRole: "previous"}
+		config := controllers.OperatorConfig{
+			ProviderRole: "next",
+			BaseDomain:   "base.domain.io",
+			ConfigMap: controllers.ConfigMapSettings{
+				AllowedNamespaces: []string{"crossplane"},
+			},
+		}
+		Expect(reconciler.ApplyOperatorConfig(config)).NotTo(Succeed())
+		Expect(reconciler.ProviderRole).To(Equal("previous"))
+	})
+})
+
+var _ = Describe("OperatorConfigWatcher", Label(unitLabel), func() {
+	var (
+		path       string
+		reconciler *controllers.ConfigMapReconciler
+		watcher    *controllers.OperatorConfigWatcher
+		queue      workqueue.TypedRateLimitingInterface[reconcile.Request]
+		cancel     context.CancelFunc
+	)
+
+	// getRequests returns the clusters enqueued by the config change watch.
+	getRequests := func() []reconcile.Request {
+		requests := []reconcile.Request{}
+		for queue.Len() > 0 {
+			request, _ := queue.Get()
+			queue.Done(request)
+			requests = append(requests, request)
+		}
+		return requests
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(operatorConfigYAML), 0o600)).To(Succeed())
+
+		_, objects := newFakeCapaCluster()
+		otherProvider := &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "vcluster", Namespace: "org-acme"},
+			Spec: capi.ClusterSpec{
+				InfrastructureRef: &corev1.ObjectReference{Kind: "VCluster", Name: "vcluster"},
+			},
+		}
+		reconciler = &controllers.ConfigMapReconciler{Client: newFakeManagementClient(append(objects, otherProvider)...)}
+		watcher = &controllers.OperatorConfigWatcher{Path: path, Reconciler: reconciler}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+
+		queue = workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+		DeferCleanup(queue.ShutDown)
+		Expect(reconciler.ConfigChangeSource().Start(ctx, queue)).To(Succeed())
+
+		done := make(chan error)
+		go func() {
+			done <- watcher.Start(ctx)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		Eventually(func() string {
+			return reconciler.ProviderRole
+		}).Should(Equal("crossplane"))
+		Eventually(queue.Len).Should(Equal(1))
+		getRequests()
+	})
+
+	It("reconciles the AWS clusters when the file changes", func() {
+		changed := []byte("apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1\nkind: OperatorConfig\nproviderRole: changed\nbaseDomain: other.domain.io\n")
+		Expect(os.WriteFile(path, changed, 0o600)).To(Succeed())
+
+		Eventually(queue.Len).WithTimeout(5 * time.Second).Should(Equal(1))
+		Expect(getRequests()).To(ConsistOf(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "org-acme", Name: "acme"}}))
+	})
+
+	It("does not reconcile the clusters when the file becomes invalid", func() {
+		Expect(os.WriteFile(path, []byte(operatorConfigYAML+"  - yaml\n"), 0o600)).To(Succeed())
+
+		Eventually(func() error {
+			return watcher.Check(nil)
+		}).WithTimeout(5 * time.Second).Should(MatchError(ContainSubstring("does not match the schema")))
+		Consistently(queue.Len).WithTimeout(500 * time.Millisecond).Should(BeZero())
+	})
+
+	It("applies changes of the file", func() {
+		changed := []byte("apiVersion: crossplane-config-operator.giantswarm.io/v1alpha1\nkind: OperatorConfig\nproviderRole: changed\nbaseDomain: other.domain.io\n")
+		Expect(os.WriteFile(path, changed, 0o600)).To(Succeed())
+
+		Eventually(func() string {
+			return reconciler.ProviderRole
+		}).WithTimeout(5 * time.Second).Should(Equal("changed"))
+		Expect(reconciler.OutputFormats).To(BeEmpty())
+		Expect(watcher.Check(nil)).To(Succeed())
+	})
+
+	It("keeps the previous config when the file becomes invalid", func() {
+		Expect(os.WriteFile(path, []byte("kind: Unknown\n"), 0o600)).To(Succeed())
+
+		Eventually(func() error {
+			return watcher.Check(nil)
+		}).WithTimeout(5 * time.Second).Should(HaveOccurred())
+		Expect(reconciler.ProviderRole).To(Equal("crossplane"))
+
+		Expect(os.WriteFile(path, []byte(operatorConfigYAML), 0o600)).To(Succeed())
+		Eventually(func() error {
+			return watcher.Check(nil)
+		}).WithTimeout(5 * time.Second).Should(Succeed())
+	})
+})
@@ -0,0 +1,139 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// OperatorConfigWatcher applies changes of the operator config file to the
+// reconciler without a restart. It runs in every replica, so standby replicas
+// take over with the current config.
+type OperatorConfigWatcher struct {
+	Path       string
+	Reconciler *ConfigMapReconciler
+
+	// The error of the last reload, reported by Check.
+	lock sync.Mutex
+	err  error
+}
+
+// Start watches the directory of the config file instead of the file itself.
+// Kubelet updates mounted ConfigMaps by swapping a symlink in the directory,
+// which a watch on the file would miss. Invalid configs are logged and the
+// previous config is kept.
+func (w *OperatorConfigWatcher) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithValues("config", w.Path)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(filepath.Dir(w.Path))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The file is applied once more, it may have changed since startup
+	var current []byte
+	w.reload(ctx, &current)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			logger.Error(err, "failed to watch operator config")
+		case <-watcher.Events:
+			w.reload(ctx, &current)
+		}
+	}
+}
+
+// reload applies the config file when its content differs from current.
+func (w *OperatorConfigWatcher) reload(ctx context.Context, current *[]byte) {
+	logger := log.FromContext(ctx).WithValues("config", w.Path)
+
+	data, err := os.ReadFile(w.Path)
+	if err != nil {
+		logger.Error(err, "failed to read operator config")
+		w.setError(errors.WithStack(err))
+		return
+	}
+	if *current != nil && bytes.Equal(data, *current) {
+		return
+	}
+	*current = data
+
+	config, err := ParseOperatorConfig(data)
+	if err != nil {
+		logger.Error(err, "invalid operator config, keeping the previous config")
+		w.setError(errors.WithStack(err))
+		return
+	}
+	err = w.Reconciler.ApplyOperatorConfig(config)
+	if err != nil {
+		logger.Error(err, "failed to apply operator config, keeping the previous config")
+		w.setError(errors.WithStack(err))
+		return
+	}
+	w.setError(nil)
+	logger.Info("Operator config applied, reconciling all clusters")
+}
+
+func (w *OperatorConfigWatcher) setError(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.err = err
+}
+
+// Check is a readiness check failing while the config file is invalid, e.g.
+// after a broken change. The operator keeps running with the previous config
+// in the meantime.
+func (w *OperatorConfigWatcher) Check(_ *http.Request) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err != nil {
+		return errors.Wrapf(w.err, "operator config %s can not be applied, running with the previous config", w.Path)
+	}
+	return nil
+}
+
+func (w *OperatorConfigWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+// operatorConfigObject stands in for the config file in the events enqueuing
+// all clusters after a change.
+func operatorConfigObject() client.Object {
+	return &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator-config"},
+	}
+}
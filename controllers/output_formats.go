@@ -0,0 +1,173 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// OutputFormat is an additional rendering of the built-in values. The YAML
+// rendering in the `values` key is always written.
+type OutputFormat string
+
+const (
+	// OutputFormatJSON writes the values as JSON to the `values.json` key.
+	OutputFormatJSON OutputFormat = "json"
+	// OutputFormatFlat writes every value to its own key, e.g. `AWS_ACCOUNT_ID`.
+	OutputFormatFlat OutputFormat = "flat"
+	// OutputFormatEnv writes the flat values as dotenv file to the `values.env` key.
+	OutputFormatEnv OutputFormat = "env"
+)
+
+const (
+	ValuesJSONKey = "values.json"
+	ValuesEnvKey  = "values.env"
+
+	// OutputFormatsAnnotation on the Cluster overrides the operator level
+	// output formats. The value is a comma separated list of formats.
+	OutputFormatsAnnotation = "crossplane-config-operator.giantswarm.io/output-formats"
+)
+
+var outputFormats = []OutputFormat{OutputFormatJSON, OutputFormatFlat, OutputFormatEnv}
+
+// ParseOutputFormats parses a comma separated list of output formats.
+func ParseOutputFormats(s string) ([]OutputFormat, error) {
+	formats := []OutputFormat{}
+	for _, value := range strings.Split(s, ",") {
+		format := OutputFormat(strings.TrimSpace(value))
+		if format == "" {
+			continue
+		}
+		if !isKnownOutputFormat(format) {
+			return nil, errors.Errorf("unknown output format %q, must be one of %v", format, outputFormats)
+		}
+		formats = append(formats, format)
+	}
+
+	return formats, nil
+}
+
+func isKnownOutputFormat(format OutputFormat) bool {
+	for _, known := range outputFormats {
+		if format == known {
+			return true
+		}
+	}
+	return false
+}
+
+// getOutputFormats returns the output formats of the cluster. An invalid
+// annotation is returned as error together with the operator level formats,
+// so the config map is still written.
+func (r *ConfigMapReconciler) getOutputFormats(cluster *capi.Cluster) ([]OutputFormat, error) {
+	value, ok := cluster.Annotations[OutputFormatsAnnotation]
+	if !ok {
+		return r.OutputFormats, nil
+	}
+
+	formats, err := ParseOutputFormats(value)
+	if err != nil {
+		return r.OutputFormats, errors.Wrapf(err, "invalid %s annotation", OutputFormatsAnnotation)
+	}
+
+	return formats, nil
+}
+
+func renderOutputFormats(values crossplaneConfigValues, formats []OutputFormat) (map[string]string, error) {
+	data := map[string]string{}
+
+	for _, format := range formats {
+		switch format {
+		case OutputFormatJSON:
+			out, err := json.MarshalIndent(values, "", "  ")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			data[ValuesJSONKey] = string(out)
+		case OutputFormatFlat:
+			for key, value := range flattenValues(values) {
+				data[key] = value
+			}
+		case OutputFormatEnv:
+			data[ValuesEnvKey] = renderEnv(flattenValues(values))
+		}
+	}
+
+	return data, nil
+}
+
+// flattenValues maps the values to environment variable style keys.
+func flattenValues(values crossplaneConfigValues) map[string]string {
+	flat := map[string]string{
+		"AWS_ACCOUNT_ID":                  values.AccountID,
+		"AWS_PARTITION":                   values.AWSPartition,
+		"AWS_REGION":                      values.Region,
+		"BASE_DOMAIN":                     values.BaseDomain,
+		"CLUSTER_NAME":                    values.ClusterName,
+		"OIDC_DOMAIN":                     values.OIDCDomain,
+		"OIDC_DOMAINS":                    strings.Join(values.OIDCDomains, ","),
+		"VPC_ID":                          values.AWSCluster.VpcID,
+		"CONTROL_PLANE_SECURITY_GROUP_ID": "",
+		"NODE_SECURITY_GROUP_ID":          "",
+		"PROVIDER_CONFIG_NAME":            values.ProviderConfig.Name,
+		"PROVIDER_CREDENTIALS_SOURCE":     values.ProviderConfig.CredentialsSource,
+		"PROVIDER_ROLE_ARN":               values.ProviderConfig.RoleARN,
+		"SHARED_PROVIDER_CONFIG_NAME":     values.ProviderConfig.SharedName,
+		"READY":                           strconv.FormatBool(values.Ready),
+		"MISSING":                         strings.Join(values.Missing, ","),
+	}
+
+	if sgs := values.AWSCluster.SecurityGroups; sgs != nil {
+		if sgs.ControlPlane != nil {
+			flat["CONTROL_PLANE_SECURITY_GROUP_ID"] = sgs.ControlPlane.ID
+		}
+		if sgs.Node != nil {
+			flat["NODE_SECURITY_GROUP_ID"] = sgs.Node.ID
+		}
+	}
+
+	return flat
+}
+
+var envSafeValue = regexp.MustCompile(`^[A-Za-z0-9._/:,@-]*$`)
+
+func renderEnv(flat map[string]string) string {
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out strings.Builder
+	for _, key := range keys {
+		value := flat[key]
+		if !envSafeValue.MatchString(value) {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&out, "%s=%s\n", key, value)
+	}
+
+	return out.String()
+}
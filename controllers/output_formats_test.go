@@ -0,0 +1,147 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler output formats", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		annotations []string
+		fakeClient  client.Client
+		reconciler  *controllers.ConfigMapReconciler
+		cluster     *capi.Cluster
+	)
+
+	getConfigMap := func() *corev1.ConfigMap {
+		configMap := &corev1.ConfigMap{}
+		err := fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)
+		Expect(err).NotTo(HaveOccurred())
+		return configMap
+	}
+
+	getCluster := func() *capi.Cluster {
+		current := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+		return current
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		annotations = nil
+	})
+
+	JustBeforeEach(func() {
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster(annotations...)
+		fakeClient = newFakeManagementClient(objects...)
+		reconciler = &controllers.ConfigMapReconciler{
+			Client:        fakeClient,
+			BaseDomain:    "base.domain.io",
+			ProviderRole:  "the-provider-role",
+			OutputFormats: []controllers.OutputFormat{controllers.OutputFormatJSON},
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("writes the operator formats", func() {
+		configMap := getConfigMap()
+		Expect(configMap.Data).To(HaveKey("values"))
+		Expect(configMap.Data).To(HaveKeyWithValue("values.json", MatchJSON(`{
+			"accountID": "123456789012",
+			"awsCluster": {
+				"securityGroups": {"controlPlane": {"id": "sg-cp"}, "node": {"id": "sg-node"}},
+				"vpcId": "vpc-1"
+			},
+			"awsPartition": "aws",
+			"baseDomain": "acme.base.domain.io",
+			"clusterName": "acme",
+			"oidcDomain": "irsa.acme.base.domain.io",
+			"oidcDomains": ["irsa.acme.base.domain.io"],
+			"providerConfig": {
+				"credentialsSource": "WebIdentity",
+				"name": "acme",
+				"roleARN": "arn:aws:iam::123456789012:role/the-provider-role"
+			},
+			"ready": true,
+			"region": "eu-west-1"
+		}`)))
+		Expect(configMap.Data).NotTo(HaveKey("values.env"))
+	})
+
+	When("the cluster selects other formats", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.OutputFormatsAnnotation, "flat,env"}
+		})
+
+		It("writes the formats of the cluster instead", func() {
+			configMap := getConfigMap()
+			Expect(configMap.Data).NotTo(HaveKey("values.json"))
+			Expect(configMap.Data).To(HaveKeyWithValue("AWS_ACCOUNT_ID", "123456789012"))
+			Expect(configMap.Data).To(HaveKeyWithValue("VPC_ID", "vpc-1"))
+			Expect(configMap.Data).To(HaveKeyWithValue("values.env", ContainSubstring("AWS_ACCOUNT_ID=123456789012")))
+		})
+	})
+
+	When("the cluster selects no formats", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.OutputFormatsAnnotation, ""}
+		})
+
+		It("only writes the values", func() {
+			Expect(getConfigMap().Data).To(HaveLen(1))
+			Expect(getConfigMap().Data).To(HaveKey("values"))
+		})
+	})
+
+	When("the annotation is invalid", func() {
+		BeforeEach(func() {
+			annotations = []string{controllers.OutputFormatsAnnotation, "json,toml"}
+		})
+
+		It("writes the operator formats", func() {
+			Expect(getConfigMap().Data).To(HaveKey("values.json"))
+		})
+
+		It("reports the annotation", func() {
+			cluster := getCluster()
+			Expect(conditions.IsFalse(cluster, controllers.ConfigMapReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(cluster, controllers.ConfigMapReadyCondition)).To(Equal(controllers.InvalidAnnotationReason))
+			Expect(conditions.GetMessage(cluster, controllers.ConfigMapReadyCondition)).To(ContainSubstring("toml"))
+		})
+
+		It("still creates the provider config", func() {
+			Expect(conditions.IsTrue(getCluster(), controllers.ProviderConfigReadyCondition)).To(BeTrue())
+		})
+	})
+})
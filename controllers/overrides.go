@@ -0,0 +1,51 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// AccountIDAnnotation on the Cluster overrides the AWS account the
+	// crossplane resources of the cluster are created in. By default it is
+	// the account of the CAPA identity.
+	AccountIDAnnotation = "crossplane-config-operator.giantswarm.io/account-id"
+	// ProviderRoleAnnotation on the Cluster overrides the operator level
+	// provider role. It accepts the same templates as --provider-role.
+	ProviderRoleAnnotation = "crossplane-config-operator.giantswarm.io/provider-role"
+)
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// getAccountID returns the account of the crossplane resources of the
+// cluster.
+func getAccountID(cluster *capi.Cluster, clusterInfo *ClusterInfo) (string, error) {
+	accountID, ok := cluster.Annotations[AccountIDAnnotation]
+	if !ok {
+		return clusterInfo.RoleArn.AccountID, nil
+	}
+
+	if !accountIDPattern.MatchString(accountID) {
+		return "", errors.Errorf("invalid %s annotation %q, must be a 12 digit AWS account ID", AccountIDAnnotation, accountID)
+	}
+
+	return accountID, nil
+}
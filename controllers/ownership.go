@@ -0,0 +1,225 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "aws-crossplane-cluster-config-operator"
+
+	// AdoptAnnotation allows the operator to take over an object it did not
+	// create. Objects without the managed-by label are left untouched unless
+	// this annotation is set to "true".
+	AdoptAnnotation = "crossplane-config-operator.giantswarm.io/adopt"
+
+	// The generated objects are labelled with the cluster they belong to, so
+	// they can be found again when their name or namespace changes or the
+	// cluster is deleted.
+	ClusterNameLabel      = capi.ClusterNameLabel
+	ClusterNamespaceLabel = "crossplane-config-operator.giantswarm.io/cluster-namespace"
+)
+
+func isManaged(obj metav1.Object) bool {
+	return obj.GetLabels()[ManagedByLabel] == ManagedByValue
+}
+
+func isAdoptable(obj metav1.Object) bool {
+	return obj.GetAnnotations()[AdoptAnnotation] == "true"
+}
+
+// isLegacy reports whether obj was created by a release before the generated
+// objects were labelled with their cluster. Those labelled ConfigMaps only as
+// managed. Objects without the managed-by label are never taken as legacy, so
+// hand-written ones are left alone.
+func isLegacy(obj metav1.Object) bool {
+	return isManaged(obj) && obj.GetLabels()[ClusterNameLabel] == ""
+}
+
+// isOwnedBy reports whether obj is managed by the operator for the cluster.
+func isOwnedBy(obj metav1.Object, cluster *capi.Cluster) bool {
+	labels := obj.GetLabels()
+	return isManaged(obj) && labels[ClusterNameLabel] == cluster.Name && labels[ClusterNamespaceLabel] == cluster.Namespace
+}
+
+func setManaged(obj metav1.Object) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ManagedByLabel] = ManagedByValue
+	obj.SetLabels(labels)
+}
+
+func setClusterLabels(obj metav1.Object, clusterName, clusterNamespace string) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ClusterNameLabel] = clusterName
+	labels[ClusterNamespaceLabel] = clusterNamespace
+	obj.SetLabels(labels)
+}
+
+// ownedBy selects all objects managed by the operator for the given cluster.
+func ownedBy(clusterName, clusterNamespace string) client.MatchingLabels {
+	return client.MatchingLabels{
+		ManagedByLabel:        ManagedByValue,
+		ClusterNameLabel:      clusterName,
+		ClusterNamespaceLabel: clusterNamespace,
+	}
+}
+
+// deleteManagedObjects deletes all objects of the given cluster scoped kind the
+// operator manages for the cluster, except the ones named in keep. A kind whose
+// CRD is not installed has nothing to delete.
+func (r *ConfigMapReconciler) deleteManagedObjects(ctx context.Context, gvk schema.GroupVersionKind, cluster *capi.Cluster, keep ...string) error {
+	logger := log.FromContext(ctx)
+
+	objects := &unstructured.UnstructuredList{}
+	objects.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	err := r.Client.List(ctx, objects, ownedBy(cluster.Name, cluster.Namespace))
+	if metaerr.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "failed to list objects", "kind", gvk.Kind)
+		return errors.WithStack(err)
+	}
+
+	for i := range objects.Items {
+		object := &objects.Items[i]
+		if slices.Contains(keep, object.GetName()) {
+			continue
+		}
+
+		logger.Info("Deleting "+gvk.Kind, "name", object.GetName())
+		err = r.Client.Delete(ctx, object)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logger.Error(err, "failed to delete object", "kind", gvk.Kind)
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// deleteObjectsByName deletes the ConfigMap and the ProviderConfigs under the
+// names rendered for the cluster and under the default names, when they are
+// owned by the cluster or legacy. Objects of releases before the cluster
+// labels can not be found by label, so they are only cleaned up this way.
+// The account of the cluster is resolved on a best effort basis, as its
+// infrastructure may already be gone.
+func (r *ConfigMapReconciler) deleteObjectsByName(ctx context.Context, cluster *capi.Cluster) error {
+	logger := log.FromContext(ctx)
+
+	candidates := []objectNames{{
+		ConfigMap:      types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name + "-crossplane-config"},
+		ProviderConfig: cluster.Name,
+	}}
+	names, err := r.getObjectNames(cluster, r.getAccountIDForDelete(ctx, cluster))
+	if err == nil {
+		err = r.checkConfigMapNamespace(cluster, names.ConfigMap.Namespace)
+	}
+	if err != nil {
+		logger.Info("Failed to render object names, only deleting objects under the default names", "error", err.Error())
+	} else {
+		candidates = append(candidates, names)
+	}
+
+	for _, names := range candidates {
+		configMap := &corev1.ConfigMap{}
+		err = r.Client.Get(ctx, names.ConfigMap, configMap)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logger.Error(err, "failed to get config map")
+			return errors.WithStack(err)
+		}
+		if err == nil && (isOwnedBy(configMap, cluster) || isLegacy(configMap)) {
+			logger.Info("Deleting ConfigMap", "configMap", names.ConfigMap)
+			err = r.Client.Delete(ctx, configMap)
+			if err != nil && !k8serrors.IsNotFound(err) {
+				logger.Error(err, "failed to delete config map")
+				return errors.WithStack(err)
+			}
+		}
+
+		for _, gk := range providerConfigKinds {
+			mapping, err := r.Client.RESTMapper().RESTMapping(gk)
+			if metaerr.IsNoMatchError(err) {
+				continue
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			providerConfig := getProviderConfig(mapping, names.ProviderConfig, cluster)
+			err = r.Client.Get(ctx, client.ObjectKeyFromObject(providerConfig), providerConfig)
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				logger.Error(err, "failed to get provider config")
+				return errors.WithStack(err)
+			}
+			if !isOwnedBy(providerConfig, cluster) && !isLegacy(providerConfig) {
+				continue
+			}
+
+			logger.Info("Deleting "+gk.Kind, "name", providerConfig.GetName())
+			err = r.Client.Delete(ctx, providerConfig)
+			if err != nil && !k8serrors.IsNotFound(err) {
+				logger.Error(err, "failed to delete provider config")
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getAccountIDForDelete returns the account ID the names of the cluster were
+// rendered with, or an empty string when it can not be resolved anymore.
+func (r *ConfigMapReconciler) getAccountIDForDelete(ctx context.Context, cluster *capi.Cluster) string {
+	clusterInfo := &ClusterInfo{}
+	if resolver := r.getClusterInfoResolvers().Get(cluster); resolver != nil {
+		resolved, err := resolver.Resolve(ctx, cluster)
+		if err == nil {
+			clusterInfo = resolved
+		}
+	}
+
+	accountID, err := getAccountID(cluster, clusterInfo)
+	if err != nil {
+		return ""
+	}
+	return accountID
+}
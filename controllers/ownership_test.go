@@ -0,0 +1,157 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler ownership", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		fakeClient     client.Client
+		reconciler     *controllers.ConfigMapReconciler
+		cluster        *capi.Cluster
+		configMap      *corev1.ConfigMap
+		providerConfig *unstructured.Unstructured
+	)
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	getCluster := func() *capi.Cluster {
+		current := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+		return current
+	}
+
+	getConfigMap := func() *corev1.ConfigMap {
+		current := &corev1.ConfigMap{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, current)).To(Succeed())
+		return current
+	}
+
+	getProviderConfig := func() *unstructured.Unstructured {
+		current := &unstructured.Unstructured{}
+		current.SetAPIVersion("aws.upbound.io/v1beta1")
+		current.SetKind("ProviderConfig")
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, current)).To(Succeed())
+		return current
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "org-acme", Name: "acme-crossplane-config"},
+			Data:       map[string]string{"values": "hand-written"},
+		}
+
+		providerConfig = &unstructured.Unstructured{}
+		providerConfig.SetAPIVersion("aws.upbound.io/v1beta1")
+		providerConfig.SetKind("ProviderConfig")
+		providerConfig.SetName("acme")
+		Expect(unstructured.SetNestedMap(providerConfig.Object, map[string]interface{}{
+			"source": "WebIdentity",
+			"webIdentity": map[string]interface{}{
+				"roleARN": "arn:aws:iam::123456789012:role/hand-written",
+			},
+		}, "spec", "credentials")).To(Succeed())
+
+		reconciler = &controllers.ConfigMapReconciler{
+			BaseDomain:   "base.domain.io",
+			ProviderRole: "the-provider-role",
+		}
+	})
+
+	JustBeforeEach(func() {
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster()
+		fakeClient = newFakeManagementClient(append(objects, configMap, providerConfig)...)
+		reconciler.Client = fakeClient
+
+		reconcile()
+	})
+
+	When("hand-written objects without labels have the rendered names", func() {
+		It("does not update them", func() {
+			Expect(getConfigMap().Data).To(Equal(map[string]string{"values": "hand-written"}))
+			Expect(getConfigMap().Labels).To(BeEmpty())
+
+			Expect(getProviderConfig().GetLabels()).To(BeEmpty())
+			Expect(getProviderConfig().Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("credentials", HaveKeyWithValue("webIdentity", HaveKeyWithValue("roleARN", "arn:aws:iam::123456789012:role/hand-written")))))
+		})
+
+		It("reports the conflicts", func() {
+			current := getCluster()
+			Expect(conditions.GetReason(current, controllers.ConfigMapReadyCondition)).To(Equal(controllers.OwnershipConflictReason))
+			Expect(conditions.GetReason(current, controllers.ProviderConfigReadyCondition)).To(Equal(controllers.OwnershipConflictReason))
+		})
+
+		It("does not delete them with the cluster", func() {
+			Expect(fakeClient.Delete(ctx, getCluster())).To(Succeed())
+			reconcile()
+
+			Expect(getConfigMap().Data).To(HaveKeyWithValue("values", "hand-written"))
+			getProviderConfig()
+		})
+	})
+
+	When("the objects are annotated to be adopted", func() {
+		BeforeEach(func() {
+			configMap.Annotations = map[string]string{controllers.AdoptAnnotation: "true"}
+			providerConfig.SetAnnotations(map[string]string{controllers.AdoptAnnotation: "true"})
+		})
+
+		It("takes them over", func() {
+			Expect(getConfigMap().Labels).To(HaveKeyWithValue(controllers.ManagedByLabel, controllers.ManagedByValue))
+			Expect(getProviderConfig().GetLabels()).To(HaveKeyWithValue(controllers.ManagedByLabel, controllers.ManagedByValue))
+			Expect(getProviderConfig().Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("credentials", HaveKeyWithValue("webIdentity", HaveKeyWithValue("roleARN", "arn:aws:iam::123456789012:role/the-provider-role")))))
+		})
+	})
+
+	// Releases before the ownership check created provider configs without
+	// labels
+	When("an unlabelled provider config has exactly the rendered spec", func() {
+		BeforeEach(func() {
+			Expect(unstructured.SetNestedField(providerConfig.Object,
+				"arn:aws:iam::123456789012:role/the-provider-role",
+				"spec", "credentials", "webIdentity", "roleARN")).To(Succeed())
+		})
+
+		It("adopts it", func() {
+			Expect(getProviderConfig().GetLabels()).To(HaveKeyWithValue(controllers.ManagedByLabel, controllers.ManagedByValue))
+			Expect(conditions.IsTrue(getCluster(), controllers.ProviderConfigReadyCondition)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// PropagatedLabelsAnnotation and PropagatedAnnotationsAnnotation record
+	// the keys copied from the Cluster, so they can be removed from the
+	// generated objects once they are removed from the Cluster or the
+	// allow-list.
+	PropagatedLabelsAnnotation      = "crossplane-config-operator.giantswarm.io/propagated-labels"
+	PropagatedAnnotationsAnnotation = "crossplane-config-operator.giantswarm.io/propagated-annotations"
+
+	operatorKeyPrefix = "crossplane-config-operator.giantswarm.io/"
+)
+
+// ParsePropagationPatterns parses a comma separated allow-list of label or
+// annotation keys. A key ending in `*` matches all keys with that prefix, e.g.
+// `release.giantswarm.io/*`.
+func ParsePropagationPatterns(s string) ([]string, error) {
+	patterns := []string{}
+	for _, value := range strings.Split(s, ",") {
+		pattern := strings.TrimSpace(value)
+		if pattern == "" {
+			continue
+		}
+
+		key, prefix := strings.CutSuffix(pattern, "*")
+		if strings.Contains(key, "*") {
+			return nil, errors.Errorf("invalid propagation pattern %q, only a trailing * is supported", pattern)
+		}
+		if !prefix {
+			if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+				return nil, errors.Errorf("invalid propagation pattern %q: %s", pattern, strings.Join(msgs, ", "))
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func matchesPropagationPattern(key string, patterns []string) bool {
+	// The operator's own keys steer ownership and overrides of the cluster
+	if strings.HasPrefix(key, operatorKeyPrefix) || key == ManagedByLabel || key == ClusterNameLabel {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// propagatedMetadata are the labels and annotations copied to the objects
+// generated for a cluster.
+type propagatedMetadata struct {
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// getPropagatedMetadata returns the allow-listed labels and annotations of
+// the cluster together with the standard account and region labels.
+func (r *ConfigMapReconciler) getPropagatedMetadata(cluster *capi.Cluster, accountID, region string) propagatedMetadata {
+	metadata := propagatedMetadata{
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+	}
+
+	for key, value := range cluster.Labels {
+		if matchesPropagationPattern(key, r.PropagateLabels) {
+			metadata.Labels[key] = value
+		}
+	}
+	for key, value := range cluster.Annotations {
+		if matchesPropagationPattern(key, r.PropagateAnnotations) {
+			metadata.Annotations[key] = value
+		}
+	}
+
+	metadata.Labels[AccountIDLabel] = accountID
+	metadata.Labels[RegionLabel] = region
+
+	return metadata
+}
+
+// setPropagatedMetadata sets the propagated labels and annotations on obj and
+// removes the ones propagated earlier that are no longer wanted.
+func setPropagatedMetadata(obj metav1.Object, metadata propagatedMetadata) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	syncPropagated(labels, metadata.Labels, annotations, PropagatedLabelsAnnotation)
+	syncPropagated(annotations, metadata.Annotations, annotations, PropagatedAnnotationsAnnotation)
+
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+}
+
+func syncPropagated(current, desired, annotations map[string]string, trackingAnnotation string) {
+	if previous := annotations[trackingAnnotation]; previous != "" {
+		for _, key := range strings.Split(previous, ",") {
+			if _, ok := desired[key]; !ok {
+				delete(current, key)
+			}
+		}
+	}
+
+	keys := []string{}
+	for key, value := range desired {
+		current[key] = value
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 {
+		delete(annotations, trackingAnnotation)
+		return
+	}
+	annotations[trackingAnnotation] = strings.Join(keys, ",")
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler propagation", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		fakeClient client.Client
+		reconciler *controllers.ConfigMapReconciler
+		cluster    *capi.Cluster
+	)
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	getObjects := func() []client.Object {
+		configMap := &corev1.ConfigMap{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)).To(Succeed())
+
+		providerConfig := &unstructured.Unstructured{}
+		providerConfig.SetAPIVersion("aws.upbound.io/v1beta1")
+		providerConfig.SetKind("ProviderConfig")
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, providerConfig)).To(Succeed())
+
+		environmentConfig := &unstructured.Unstructured{}
+		environmentConfig.SetAPIVersion("apiextensions.crossplane.io/v1beta1")
+		environmentConfig.SetKind("EnvironmentConfig")
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "acme"}, environmentConfig)).To(Succeed())
+
+		return []client.Object{configMap, providerConfig, environmentConfig}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster(
+			"release.giantswarm.io/version", "29.1.0",
+			"giantswarm.io/description", "the acme cluster",
+		)
+		cluster.Labels = map[string]string{
+			"giantswarm.io/organization":     "acme",
+			"giantswarm.io/service-priority": "highest",
+		}
+		fakeClient = newFakeManagementClient(objects...)
+		reconciler = &controllers.ConfigMapReconciler{
+			Client:               fakeClient,
+			BaseDomain:           "base.domain.io",
+			ProviderRole:         "the-provider-role",
+			PropagateLabels:      []string{"giantswarm.io/organization"},
+			PropagateAnnotations: []string{"release.giantswarm.io/*"},
+		}
+
+		reconcile()
+	})
+
+	It("copies the allow-listed labels and annotations to the generated objects", func() {
+		for _, obj := range getObjects() {
+			Expect(obj.GetLabels()).To(HaveKeyWithValue("giantswarm.io/organization", "acme"), obj.GetName())
+			Expect(obj.GetLabels()).NotTo(HaveKey("giantswarm.io/service-priority"))
+			Expect(obj.GetAnnotations()).To(HaveKeyWithValue("release.giantswarm.io/version", "29.1.0"))
+			Expect(obj.GetAnnotations()).NotTo(HaveKey("giantswarm.io/description"))
+		}
+	})
+
+	It("labels the generated objects with the account and region", func() {
+		for _, obj := range getObjects() {
+			Expect(obj.GetLabels()).To(HaveKeyWithValue(controllers.AccountIDLabel, "123456789012"))
+			Expect(obj.GetLabels()).To(HaveKeyWithValue(controllers.RegionLabel, "eu-west-1"))
+		}
+	})
+
+	When("the cluster drops propagated metadata", func() {
+		BeforeEach(func() {
+			current := &capi.Cluster{}
+			Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+			delete(current.Labels, "giantswarm.io/organization")
+			delete(current.Annotations, "release.giantswarm.io/version")
+			Expect(fakeClient.Update(ctx, current)).To(Succeed())
+
+			reconcile()
+		})
+
+		It("removes it from the generated objects", func() {
+			for _, obj := range getObjects() {
+				Expect(obj.GetLabels()).NotTo(HaveKey("giantswarm.io/organization"))
+				Expect(obj.GetAnnotations()).NotTo(HaveKey("release.giantswarm.io/version"))
+				Expect(obj.GetLabels()).To(HaveKey(controllers.AccountIDLabel))
+			}
+		})
+	})
+
+	When("a key is no longer allow-listed", func() {
+		BeforeEach(func() {
+			reconciler.PropagateAnnotations = nil
+			reconcile()
+		})
+
+		It("removes it from the generated objects", func() {
+			for _, obj := range getObjects() {
+				Expect(obj.GetAnnotations()).NotTo(HaveKey("release.giantswarm.io/version"))
+				Expect(obj.GetAnnotations()).NotTo(HaveKey(controllers.PropagatedAnnotationsAnnotation))
+				Expect(obj.GetLabels()).To(HaveKeyWithValue("giantswarm.io/organization", "acme"))
+			}
+		})
+	})
+})
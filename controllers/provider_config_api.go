@@ -0,0 +1,159 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// providerConfigKinds are the upbound provider-aws ProviderConfig kinds the
+// operator can render, in order of preference. The cluster scoped
+// aws.upbound.io kind comes first to keep existing installations unchanged.
+// The aws.m.upbound.io kinds are served by Crossplane v2 providers.
+var providerConfigKinds = []schema.GroupKind{
+	{Group: "aws.upbound.io", Kind: "ProviderConfig"},
+	{Group: "aws.m.upbound.io", Kind: "ClusterProviderConfig"},
+	{Group: "aws.m.upbound.io", Kind: "ProviderConfig"},
+}
+
+// ParseProviderConfigAPI parses a ProviderConfig API in the form
+// `Kind.group` or `Kind.version.group`, e.g. `ClusterProviderConfig.aws.m.upbound.io`
+// or `ProviderConfig.v1beta1.aws.upbound.io`. An empty string selects the API
+// through discovery.
+func ParseProviderConfigAPI(s string) (schema.GroupKind, string, error) {
+	if s == "" {
+		return schema.GroupKind{}, "", nil
+	}
+
+	kind, rest, _ := strings.Cut(s, ".")
+	for _, gk := range providerConfigKinds {
+		if gk.Kind != kind {
+			continue
+		}
+		if rest == gk.Group {
+			return gk, "", nil
+		}
+		if version, ok := strings.CutSuffix(rest, "."+gk.Group); ok && version != "" && !strings.Contains(version, ".") {
+			return gk, version, nil
+		}
+	}
+
+	return schema.GroupKind{}, "", errors.Errorf("unsupported provider config api %q, must be one of %v", s, providerConfigKinds)
+}
+
+// getProviderConfigMapping returns the ProviderConfig kind and version to
+// render. Without an explicit choice the first served kind of
+// providerConfigKinds is used in its preferred version. A NoKindMatchError is
+// returned when none is served.
+func (r *ConfigMapReconciler) getProviderConfigMapping(mapper metaerr.RESTMapper) (*metaerr.RESTMapping, error) {
+	if !r.ProviderConfigKind.Empty() {
+		versions := []string{}
+		if r.ProviderConfigVersion != "" {
+			versions = append(versions, r.ProviderConfigVersion)
+		}
+		mapping, err := mapper.RESTMapping(r.ProviderConfigKind, versions...)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return mapping, nil
+	}
+
+	for _, gk := range providerConfigKinds {
+		mapping, err := mapper.RESTMapping(gk)
+		if metaerr.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return mapping, nil
+	}
+
+	return nil, errors.WithStack(&metaerr.NoKindMatchError{GroupKind: providerConfigKinds[0]})
+}
+
+// ProviderConfigAPIChecker returns a readiness check failing while the
+// ProviderConfig API the operator renders is not served by mapper, e.g.
+// before provider-aws is installed.
+func (r *ConfigMapReconciler) ProviderConfigAPIChecker(mapper metaerr.RESTMapper) healthz.Checker {
+	return func(_ *http.Request) error {
+		r.settingsLock.RLock()
+		defer r.settingsLock.RUnlock()
+
+		_, err := r.getProviderConfigMapping(mapper)
+		if err != nil {
+			return errors.Wrap(err, "no supported ProviderConfig API is served")
+		}
+		return nil
+	}
+}
+
+// getProviderConfig returns an empty ProviderConfig of the mapped kind.
+// Namespaced kinds live in the namespace of the cluster.
+func getProviderConfig(mapping *metaerr.RESTMapping, name string, cluster *capi.Cluster) *unstructured.Unstructured {
+	providerConfig := &unstructured.Unstructured{}
+	providerConfig.Object = map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+	}
+	providerConfig.SetGroupVersionKind(mapping.GroupVersionKind)
+	if mapping.Scope.Name() == metaerr.RESTScopeNameNamespace {
+		providerConfig.SetNamespace(cluster.Namespace)
+	}
+
+	return providerConfig
+}
+
+// deleteProviderConfigs deletes the ProviderConfigs of the cluster of every
+// served kind except the ones in keep, so switching kinds or names does not
+// leave old objects behind.
+func (r *ConfigMapReconciler) deleteProviderConfigs(ctx context.Context, cluster *capi.Cluster, keep ...*unstructured.Unstructured) error {
+	mapper := r.Client.RESTMapper()
+
+	for _, gk := range providerConfigKinds {
+		mapping, err := mapper.RESTMapping(gk)
+		if metaerr.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		keepNames := []string{}
+		for _, object := range keep {
+			if object.GroupVersionKind().GroupKind() == gk {
+				keepNames = append(keepNames, object.GetName())
+			}
+		}
+		err = r.deleteManagedObjects(ctx, mapping.GroupVersionKind, cluster, keepNames...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
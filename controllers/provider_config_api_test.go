@@ -0,0 +1,88 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ParseProviderConfigAPI", Label(unitLabel), func() {
+	It("parses a kind and group", func() {
+		gk, version, err := controllers.ParseProviderConfigAPI("ClusterProviderConfig.aws.m.upbound.io")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gk).To(Equal(schema.GroupKind{Group: "aws.m.upbound.io", Kind: "ClusterProviderConfig"}))
+		Expect(version).To(BeEmpty())
+	})
+
+	It("parses a kind, version and group", func() {
+		gk, version, err := controllers.ParseProviderConfigAPI("ProviderConfig.v1beta1.aws.upbound.io")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gk).To(Equal(schema.GroupKind{Group: "aws.upbound.io", Kind: "ProviderConfig"}))
+		Expect(version).To(Equal("v1beta1"))
+	})
+
+	It("does not confuse the group of a namespaced kind with a version", func() {
+		gk, version, err := controllers.ParseProviderConfigAPI("ProviderConfig.aws.m.upbound.io")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gk).To(Equal(schema.GroupKind{Group: "aws.m.upbound.io", Kind: "ProviderConfig"}))
+		Expect(version).To(BeEmpty())
+	})
+
+	It("returns nothing for an empty string", func() {
+		gk, version, err := controllers.ParseProviderConfigAPI("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gk.Empty()).To(BeTrue())
+		Expect(version).To(BeEmpty())
+	})
+
+	It("rejects unsupported kinds", func() {
+		_, _, err := controllers.ParseProviderConfigAPI("ProviderConfig.gcp.upbound.io")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ProviderConfigAPIChecker", Label(unitLabel), func() {
+	var (
+		mapper     *meta.DefaultRESTMapper
+		reconciler *controllers.ConfigMapReconciler
+	)
+
+	BeforeEach(func() {
+		mapper = meta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "aws.m.upbound.io", Version: "v1beta1"}})
+		reconciler = &controllers.ConfigMapReconciler{}
+	})
+
+	It("fails while no supported API is served", func() {
+		Expect(reconciler.ProviderConfigAPIChecker(mapper)(nil)).To(MatchError(ContainSubstring("no supported ProviderConfig API is served")))
+	})
+
+	It("succeeds once a supported API is served", func() {
+		mapper.Add(schema.GroupVersionKind{Group: "aws.m.upbound.io", Version: "v1beta1", Kind: "ClusterProviderConfig"}, meta.RESTScopeRoot)
+		Expect(reconciler.ProviderConfigAPIChecker(mapper)(nil)).To(Succeed())
+	})
+
+	It("checks the configured API", func() {
+		mapper.Add(schema.GroupVersionKind{Group: "aws.m.upbound.io", Version: "v1beta1", Kind: "ClusterProviderConfig"}, meta.RESTScopeRoot)
+		reconciler.ProviderConfigKind = schema.GroupKind{Group: "aws.upbound.io", Kind: "ProviderConfig"}
+		Expect(reconciler.ProviderConfigAPIChecker(mapper)(nil)).NotTo(Succeed())
+	})
+})
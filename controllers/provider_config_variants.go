@@ -0,0 +1,150 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+// ProviderConfigVariantsAnnotation on the Cluster replaces the operator level
+// ProviderConfig variants. The value is a YAML or JSON list of variants.
+const ProviderConfigVariantsAnnotation = "crossplane-config-operator.giantswarm.io/provider-config-variants"
+
+// ProviderConfigVariant is an additional ProviderConfig of a cluster with
+// different permissions, e.g. a read-only role. It is named after the
+// ProviderConfig of the cluster with the suffix appended, `<name>-<suffix>`.
+type ProviderConfigVariant struct {
+	Suffix string `json:"suffix"`
+	// Role is a provider role template like --provider-role. The default
+	// provider role is used when empty.
+	Role string `json:"role,omitempty"`
+	// AssumeRoleChain are role templates assumed in order after the role.
+	AssumeRoleChain []string `json:"assumeRoleChain,omitempty"`
+}
+
+// providerConfigVariant is a variant resolved for a cluster.
+type providerConfigVariant struct {
+	Name        string
+	Credentials providerCredentials
+}
+
+// ParseProviderConfigVariants parses a YAML or JSON list of variants.
+func ParseProviderConfigVariants(s string) ([]ProviderConfigVariant, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	variants := []ProviderConfigVariant{}
+	err := yaml.UnmarshalStrict([]byte(s), &variants)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse provider config variants")
+	}
+
+	err = validateProviderConfigVariants(variants)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return variants, nil
+}
+
+// validateProviderConfigVariants checks that the suffixes are valid and
+// unique.
+func validateProviderConfigVariants(variants []ProviderConfigVariant) error {
+	suffixes := map[string]bool{}
+	for _, variant := range variants {
+		if msgs := validation.IsDNS1123Label(variant.Suffix); len(msgs) > 0 {
+			return errors.Errorf("invalid provider config variant suffix %q: %s", variant.Suffix, strings.Join(msgs, ", "))
+		}
+		if suffixes[variant.Suffix] {
+			return errors.Errorf("duplicate provider config variant suffix %q", variant.Suffix)
+		}
+		suffixes[variant.Suffix] = true
+	}
+
+	return nil
+}
+
+func (r *ConfigMapReconciler) getProviderConfigVariants(cluster *capi.Cluster) ([]ProviderConfigVariant, error) {
+	value, ok := cluster.Annotations[ProviderConfigVariantsAnnotation]
+	if !ok {
+		return r.ProviderConfigVariants, nil
+	}
+
+	variants, err := ParseProviderConfigVariants(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s annotation", ProviderConfigVariantsAnnotation)
+	}
+
+	return variants, nil
+}
+
+// resolveProviderConfigVariants resolves the variants of the cluster based
+// on the credentials of its default ProviderConfig. The role of a variant
+// replaces the provider role. With the Secret source there is no provider
+// role, so it is assumed first instead.
+func (r *ConfigMapReconciler) resolveProviderConfigVariants(cluster *capi.Cluster, name string, credentials providerCredentials, accountID, region string) ([]providerConfigVariant, error) {
+	variants, err := r.getProviderConfigVariants(cluster)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	data := getRoleTemplateData(cluster, accountID, region)
+	resolved := []providerConfigVariant{}
+	for _, variant := range variants {
+		variantCredentials := credentials
+		variantCredentials.AssumeRoleChain = nil
+
+		if variant.Role != "" {
+			roleARN, err := renderRoleARN(variant.Role, data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid role of provider config variant %q", variant.Suffix)
+			}
+
+			if variantCredentials.Source == CredentialsSourceSecret {
+				variantCredentials.AssumeRoleChain = append(variantCredentials.AssumeRoleChain, roleARN)
+			} else {
+				variantCredentials.RoleARN = roleARN
+			}
+		}
+
+		for _, role := range variant.AssumeRoleChain {
+			roleARN, err := renderRoleARN(role, data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid assumeRoleChain of provider config variant %q", variant.Suffix)
+			}
+			variantCredentials.AssumeRoleChain = append(variantCredentials.AssumeRoleChain, roleARN)
+		}
+
+		variantName := name + "-" + variant.Suffix
+		if msgs := validation.IsDNS1123Subdomain(variantName); len(msgs) > 0 {
+			return nil, errors.Errorf("invalid provider config variant name %q: %s", variantName, strings.Join(msgs, ", "))
+		}
+
+		resolved = append(resolved, providerConfigVariant{
+			Name:        variantName,
+			Credentials: variantCredentials,
+		})
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ParseProviderConfigVariants", Label(unitLabel), func() {
+	It("returns no variants for an empty string", func() {
+		variants, err := controllers.ParseProviderConfigVariants("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(variants).To(BeEmpty())
+	})
+
+	It("parses YAML", func() {
+		variants, err := controllers.ParseProviderConfigVariants(`
+- suffix: readonly
+  role: crossplane-readonly
+  assumeRoleChain:
+  - arn:aws:iam::999999999999:role/audit
+`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(variants).To(Equal([]controllers.ProviderConfigVariant{{
+			Suffix:          "readonly",
+			Role:            "crossplane-readonly",
+			AssumeRoleChain: []string{"arn:aws:iam::999999999999:role/audit"},
+		}}))
+	})
+
+	It("parses JSON", func() {
+		variants, err := controllers.ParseProviderConfigVariants(`[{"suffix": "admin"}]`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(variants).To(Equal([]controllers.ProviderConfigVariant{{Suffix: "admin"}}))
+	})
+
+	It("rejects invalid suffixes", func() {
+		_, err := controllers.ParseProviderConfigVariants(`[{"suffix": "Read_Only"}]`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects duplicate suffixes", func() {
+		_, err := controllers.ParseProviderConfigVariants(`[{"suffix": "admin"}, {"suffix": "admin"}]`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects unknown fields", func() {
+		_, err := controllers.ParseProviderConfigVariants(`[{"suffix": "admin", "roleArn": "x"}]`)
+		Expect(err).To(HaveOccurred())
+	})
+})
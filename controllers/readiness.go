@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+)
+
+// Paths of the required values, as listed in `missing` while they are not
+// known yet.
+const (
+	VpcIDField                     = "awsCluster.vpcId"
+	SubnetsField                   = "awsCluster.subnets"
+	ControlPlaneSecurityGroupField = "awsCluster.securityGroups.controlPlane"
+	NodeSecurityGroupField         = "awsCluster.securityGroups.node"
+	OIDCDomainField                = "oidcDomain"
+)
+
+const (
+	// Bounds of the delay between reconciles while the infrastructure is not
+	// ready. The delay doubles with every reconcile, see
+	// getInfrastructureRequeueAfter.
+	minInfrastructureRequeueAfter = 10 * time.Second
+	maxInfrastructureRequeueAfter = 5 * time.Minute
+)
+
+// getMissingFields returns the sorted paths of the required values that are
+// not known, given whether each of them is known.
+func getMissingFields(required map[string]bool) []string {
+	missing := []string{}
+	for field, known := range required {
+		if !known {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// markInfrastructureReadyCondition reports the missing values on the cluster
+// and returns how long to wait before reconciling again. Nothing else
+// triggers a reconcile when the infrastructure objects change, so the cluster
+// is requeued until all required values are known.
+func markInfrastructureReadyCondition(cluster *capi.Cluster, clusterInfo *ClusterInfo) time.Duration {
+	if len(clusterInfo.Missing) == 0 {
+		conditions.MarkTrue(cluster, InfrastructureReadyCondition)
+		return 0
+	}
+
+	conditions.MarkFalse(cluster, InfrastructureReadyCondition, WaitingForInfrastructureReason, capi.ConditionSeverityInfo,
+		"waiting for %s", strings.Join(clusterInfo.Missing, ", "))
+
+	since := time.Now()
+	if lastTransitionTime := conditions.GetLastTransitionTime(cluster, InfrastructureReadyCondition); lastTransitionTime != nil {
+		since = lastTransitionTime.Time
+	}
+	return getInfrastructureRequeueAfter(time.Since(since))
+}
+
+// getInfrastructureRequeueAfter waits as long as the cluster has been waiting
+// already, so the delay doubles with every reconcile.
+func getInfrastructureRequeueAfter(waiting time.Duration) time.Duration {
+	return min(max(waiting, minInfrastructureRequeueAfter), maxInfrastructureRequeueAfter)
+}
@@ -0,0 +1,299 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// renderAPI is an API served by the fake management cluster of Render.
+type renderAPI struct {
+	gvk   schema.GroupVersionKind
+	scope metaerr.RESTScope
+}
+
+// renderAPIs are the APIs of the fake management cluster besides the built-in
+// types, as if provider-aws, provider-kubernetes, provider-helm and Crossplane
+// were installed. Cluster scoped kinds are listed so their namespace is
+// ignored like the API server does.
+var renderAPIs = []renderAPI{
+	{gvk: schema.GroupVersionKind{Group: "aws.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}, scope: metaerr.RESTScopeRoot},
+	{gvk: schema.GroupVersionKind{Group: "aws.m.upbound.io", Version: "v1beta1", Kind: "ClusterProviderConfig"}, scope: metaerr.RESTScopeRoot},
+	{gvk: schema.GroupVersionKind{Group: "aws.m.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}, scope: metaerr.RESTScopeNamespace},
+	{gvk: environmentConfigKind.WithVersion("v1beta1"), scope: metaerr.RESTScopeRoot},
+	{gvk: workloadProviderConfigGVKs[0], scope: metaerr.RESTScopeRoot},
+	{gvk: workloadProviderConfigGVKs[1], scope: metaerr.RESTScopeRoot},
+	{gvk: capa.GroupVersion.WithKind("AWSClusterRoleIdentity"), scope: metaerr.RESTScopeRoot},
+	{gvk: capa.GroupVersion.WithKind("AWSClusterStaticIdentity"), scope: metaerr.RESTScopeRoot},
+	{gvk: capa.GroupVersion.WithKind("AWSClusterControllerIdentity"), scope: metaerr.RESTScopeRoot},
+}
+
+// Render reconciles the Clusters in objects against a fake management
+// cluster holding objects and returns the objects the operator writes for
+// them, e.g. the ConfigMap and the ProviderConfigs, sorted by kind and name.
+// The Clusters themselves are left out. It runs the same code as the
+// controller, so the result matches what the operator creates for the given
+// config, assuming all supported CRDs are installed and the ProviderConfig
+// API is the pinned one or else aws.upbound.io.
+func Render(ctx context.Context, scheme *runtime.Scheme, config OperatorConfig, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	logger := log.FromContext(ctx)
+
+	s, err := config.settings()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	mapper := getRenderRESTMapper(s)
+	initObjects := []client.Object{}
+	clusters := []types.NamespacedName{}
+	for _, object := range objects {
+		object = object.DeepCopy()
+		if isClusterScoped(mapper, object.GroupVersionKind()) {
+			object.SetNamespace("")
+		}
+		if object.GroupVersionKind().GroupKind() == capi.GroupVersion.WithKind("Cluster").GroupKind() {
+			clusters = append(clusters, client.ObjectKeyFromObject(object))
+		}
+		initObjects = append(initObjects, object)
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRESTMapper(mapper).
+		WithObjects(initObjects...).
+		WithStatusSubresource(&capi.Cluster{}).
+		Build()
+	c := &renderClient{Client: fakeClient, mapper: mapper, written: map[renderedObject]bool{}}
+
+	reconciler := &ConfigMapReconciler{Client: c}
+	err = reconciler.ApplyOperatorConfig(config)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].String() < clusters[j].String()
+	})
+	for _, cluster := range clusters {
+		_, err = reconciler.Reconcile(log.IntoContext(ctx, logger.WithValues("Cluster", cluster)), ctrl.Request{NamespacedName: cluster})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to render cluster %s", cluster)
+		}
+	}
+
+	return c.getWrittenObjects(ctx)
+}
+
+func getRenderRESTMapper(s operatorSettings) metaerr.RESTMapper {
+	// The pinned version comes first, so it is also used when looking up
+	// the kind without a version
+	groupVersions := []schema.GroupVersion{}
+	if s.providerConfigVersion != "" {
+		groupVersions = append(groupVersions, schema.GroupVersion{Group: s.providerConfigKind.Group, Version: s.providerConfigVersion})
+	}
+	for _, api := range renderAPIs {
+		groupVersions = append(groupVersions, api.gvk.GroupVersion())
+	}
+
+	mapper := metaerr.NewDefaultRESTMapper(groupVersions)
+	for _, api := range renderAPIs {
+		mapper.Add(api.gvk, api.scope)
+		if s.providerConfigVersion != "" && api.gvk.GroupKind() == s.providerConfigKind {
+			mapper.Add(s.providerConfigKind.WithVersion(s.providerConfigVersion), api.scope)
+		}
+	}
+
+	return mapper
+}
+
+func isClusterScoped(mapper metaerr.RESTMapper, gvk schema.GroupVersionKind) bool {
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil && mapping.Scope.Name() == metaerr.RESTScopeNameRoot
+}
+
+// renderedObject identifies an object written during Render.
+type renderedObject struct {
+	gvk schema.GroupVersionKind
+	key types.NamespacedName
+}
+
+// renderClient records the objects written by the reconciler. Gets of cluster
+// scoped objects ignore the namespace, which the fake client does not.
+type renderClient struct {
+	client.Client
+	mapper  metaerr.RESTMapper
+	written map[renderedObject]bool
+}
+
+func (c *renderClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if isClusterScoped(c.mapper, gvk) {
+		key.Namespace = ""
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *renderClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	err := c.record(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *renderClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	err := c.record(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *renderClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	err := c.record(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *renderClient) record(obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.written[renderedObject{gvk: gvk, key: client.ObjectKeyFromObject(obj)}] = true
+	return nil
+}
+
+// getWrittenObjects returns the written objects except Clusters and deleted
+// objects, without the fields set by the API server.
+func (c *renderClient) getWrittenObjects(ctx context.Context) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+	for written := range c.written {
+		if written.gvk.GroupKind() == capi.GroupVersion.WithKind("Cluster").GroupKind() {
+			continue
+		}
+
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(written.gvk)
+		err := c.Get(ctx, written.key, object)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, field := range ignoredMetadataFields {
+			unstructured.RemoveNestedField(object.Object, "metadata", field)
+		}
+		objects = append(objects, object)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if a.GetKind() != b.GetKind() {
+			return a.GetKind() < b.GetKind()
+		}
+		if a.GetAPIVersion() != b.GetAPIVersion() {
+			return a.GetAPIVersion() < b.GetAPIVersion()
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+
+	return objects, nil
+}
+
+// ReadManifests decodes the objects of a YAML or JSON stream with any number
+// of documents. Lists are expanded into their items.
+func ReadManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+
+	objects := []*unstructured.Unstructured{}
+	for {
+		content := map[string]interface{}{}
+		err := decoder.Decode(&content)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode manifest")
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		object := &unstructured.Unstructured{Object: content}
+		if object.IsList() {
+			err = object.EachListItem(func(item runtime.Object) error {
+				objects = append(objects, item.(*unstructured.Unstructured))
+				return nil
+			})
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			continue
+		}
+		if object.GetAPIVersion() == "" || object.GetKind() == "" || object.GetName() == "" {
+			return nil, errors.Errorf("manifest without apiVersion, kind or name: %v", content)
+		}
+		objects = append(objects, object)
+	}
+}
+
+// WriteManifests writes the objects as a YAML stream.
+func WriteManifests(w io.Writer, objects []*unstructured.Unstructured) error {
+	for _, object := range objects {
+		data, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = fmt.Fprintf(w, "---\n%s", data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("Render", Label(unitLabel), func() {
+	var scheme *runtime.Scheme
+
+	BeforeEach(func() {
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(capi.AddToScheme(scheme)).To(Succeed())
+		Expect(capa.AddToScheme(scheme)).To(Succeed())
+		Expect(eks.AddToScheme(scheme)).To(Succeed())
+		Expect(rosa.AddToScheme(scheme)).To(Succeed())
+	})
+
+	// The golden files in testdata/render/<case> are updated with
+	// `go run . render --config config.yaml input.yaml > output.yaml`.
+	DescribeTable("renders the golden files",
+		func(name string) {
+			dir := filepath.Join("testdata", "render", name)
+			config, err := controllers.LoadOperatorConfig(filepath.Join(dir, "config.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+
+			input, err := os.Open(filepath.Join(dir, "input.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			defer input.Close()
+			objects, err := controllers.ReadManifests(input)
+			Expect(err).NotTo(HaveOccurred())
+
+			rendered, err := controllers.Render(context.Background(), scheme, config, objects)
+			Expect(err).NotTo(HaveOccurred())
+
+			output := &bytes.Buffer{}
+			Expect(controllers.WriteManifests(output, rendered)).To(Succeed())
+			expected, err := os.ReadFile(filepath.Join(dir, "output.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output.String()).To(Equal(string(expected)))
+		},
+		Entry("CAPA cluster", "capa"),
+		Entry("EKS cluster with variants", "eks"),
+	)
+
+	It("does not modify the input objects", func() {
+		input, err := os.Open(filepath.Join("testdata", "render", "capa", "input.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		defer input.Close()
+		objects, err := controllers.ReadManifests(input)
+		Expect(err).NotTo(HaveOccurred())
+		config := controllers.OperatorConfig{ProviderRole: "crossplane", BaseDomain: "base.example.com"}
+
+		rendered, err := controllers.Render(context.Background(), scheme, config, objects)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).NotTo(BeEmpty())
+		Expect(objects[0].GetKind()).To(Equal("Cluster"))
+		Expect(objects[0].GetFinalizers()).To(BeEmpty())
+	})
+
+	It("renders nothing for other clusters", func() {
+		objects, err := controllers.ReadManifests(strings.NewReader(`
+apiVersion: cluster.x-k8s.io/v1beta1
+kind: Cluster
+metadata:
+  name: acme
+  namespace: org-acme
+spec:
+  infrastructureRef:
+    kind: AzureCluster
+`))
+		Expect(err).NotTo(HaveOccurred())
+		config := controllers.OperatorConfig{ProviderRole: "crossplane", BaseDomain: "base.example.com"}
+
+		rendered, err := controllers.Render(context.Background(), scheme, config, objects)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(BeEmpty())
+	})
+
+	It("expands lists and rejects incomplete manifests", func() {
+		objects, err := controllers.ReadManifests(strings.NewReader(`
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: a
+  - apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: b
+---
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(HaveLen(2))
+
+		_, err = controllers.ReadManifests(strings.NewReader("kind: ConfigMap\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rosaManagedOIDCDomain is the issuer domain of the OIDC configs managed by
+// Red Hat, used until the control plane reports its OIDC endpoint.
+const rosaManagedOIDCDomain = "oidc.op1.openshiftapps.com"
+
+// ROSAClusterInfoResolver resolves clusters backed by the ROSAControlPlane
+// the control plane ref of the cluster points at.
+type ROSAClusterInfoResolver struct {
+	Client client.Client
+}
+
+func (r *ROSAClusterInfoResolver) Resolve(ctx context.Context, cluster *capi.Cluster) (*ClusterInfo, error) {
+	if cluster.Spec.ControlPlaneRef == nil {
+		return nil, errors.New("cluster has no control plane ref")
+	}
+
+	name := types.NamespacedName{
+		Name:      cluster.Spec.ControlPlaneRef.Name,
+		Namespace: cluster.Spec.ControlPlaneRef.Namespace,
+	}
+	if name.Namespace == "" {
+		name.Namespace = cluster.Namespace
+	}
+
+	controlPlane := &rosa.ROSAControlPlane{}
+	err := r.Client.Get(ctx, name, controlPlane)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The control plane is usually not named like the cluster, the
+	// reconciler looks the cluster up by the name in the cluster info.
+	clusterInfo := &ClusterInfo{
+		ROSAControlPlane: controlPlane,
+		Name:             cluster.Name,
+		Namespace:        cluster.Namespace,
+		Region:           controlPlane.Spec.Region,
+		AWSPartition:     getPartition(controlPlane.Spec.Region),
+		Subnets:          controlPlane.Spec.Subnets,
+	}
+
+	clusterInfo.RoleArn, err = getROSARoleARN(ctx, r.Client, controlPlane)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cluster role")
+	}
+
+	clusterInfo.OIDCDomain, err = getROSAOIDCDomain(controlPlane)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get OIDC domain")
+	}
+	clusterInfo.OIDCDomains = []string{clusterInfo.OIDCDomain}
+
+	// ROSA clusters have no VPC ID in their spec, so it is optional
+	clusterInfo.Missing = getMissingFields(map[string]bool{
+		SubnetsField: len(clusterInfo.Subnets) > 0,
+	})
+
+	return clusterInfo, nil
+}
+
+// getROSARoleARN returns the role of the AWSClusterRoleIdentity of the control
+// plane. ROSA clusters often use the controller identity instead, so the
+// installer role, which lives in the cluster account, is the fallback.
+func getROSARoleARN(ctx context.Context, c client.Client, controlPlane *rosa.ROSAControlPlane) (arn.ARN, error) {
+	identityRef := controlPlane.Spec.IdentityRef
+	if identityRef != nil && identityRef.Kind == "AWSClusterRoleIdentity" {
+		return getIdentityRoleARN(ctx, c, identityRef, controlPlane.Namespace)
+	}
+
+	roleARN, err := arn.Parse(controlPlane.Spec.InstallerRoleARN)
+	if err != nil {
+		return arn.ARN{}, errors.Wrap(err, "failed to parse installer role arn")
+	}
+
+	return roleARN, nil
+}
+
+func getROSAOIDCDomain(controlPlane *rosa.ROSAControlPlane) (string, error) {
+	if endpoint := controlPlane.Status.OIDCEndpointURL; endpoint != "" {
+		domain := strings.TrimPrefix(endpoint, "https://")
+		return strings.TrimSuffix(domain, "/"), nil
+	}
+
+	if controlPlane.Spec.OIDCID == "" {
+		return "", errors.New("control plane has neither OIDC endpoint nor OIDC config ID")
+	}
+
+	return rosaManagedOIDCDomain + "/" + controlPlane.Spec.OIDCID, nil
+}
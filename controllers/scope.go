@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterScope limits the clusters reconciled by an operator instance, e.g.
+// to run one instance per customer segment with its own provider role. The
+// zero value reconciles all clusters.
+type ClusterScope struct {
+	// Namespaces of the reconciled clusters, all namespaces when empty.
+	Namespaces []string
+	// Selector on the labels of the reconciled clusters, all clusters when
+	// nil.
+	Selector labels.Selector
+}
+
+// ParseClusterScope parses a comma separated list of namespaces and a label
+// selector, e.g. `giantswarm.io/organization in (acme,example)`.
+func ParseClusterScope(namespaces, selector string) (ClusterScope, error) {
+	scope := ClusterScope{}
+
+	for _, value := range strings.Split(namespaces, ",") {
+		namespace := strings.TrimSpace(value)
+		if namespace == "" {
+			continue
+		}
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			return ClusterScope{}, errors.Errorf("invalid namespace %q: %s", namespace, strings.Join(msgs, ", "))
+		}
+		if !slices.Contains(scope.Namespaces, namespace) {
+			scope.Namespaces = append(scope.Namespaces, namespace)
+		}
+	}
+
+	if strings.TrimSpace(selector) != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return ClusterScope{}, errors.Wrapf(err, "invalid cluster selector %q", selector)
+		}
+		scope.Selector = parsed
+	}
+
+	return scope, nil
+}
+
+// Contains returns whether the cluster is reconciled by this instance.
+func (s ClusterScope) Contains(cluster *capi.Cluster) bool {
+	if !s.containsNamespace(cluster.Namespace) {
+		return false
+	}
+	return s.Selector == nil || s.Selector.Matches(labels.Set(cluster.Labels))
+}
+
+func (s ClusterScope) containsNamespace(namespace string) bool {
+	return len(s.Namespaces) == 0 || slices.Contains(s.Namespaces, namespace)
+}
+
+// listNamespaces are the namespaces to list objects in without a cache,
+// metav1.NamespaceAll for all namespaces. Listing namespace by namespace works
+// with the namespaced Roles of a restricted scope.
+func (s ClusterScope) listNamespaces() []string {
+	if len(s.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return s.Namespaces
+}
+
+// isObservable returns whether the cache of this instance would contain a
+// cluster in the namespace if it exists. Clusters outside the namespaces or
+// not matching the selector look like they don't exist.
+func (s ClusterScope) isObservable(namespace string) bool {
+	return s.containsNamespace(namespace) && s.Selector == nil
+}
+
+// CheckConfigMapSettings rejects config map settings that can write
+// ConfigMaps outside the namespaces of the scope, where the instance has
+// neither Roles nor a cache. With namespaces set, ConfigMaps can only be
+// written to the namespace of their cluster.
+func (s ClusterScope) CheckConfigMapSettings(settings ConfigMapSettings) error {
+	if len(s.Namespaces) == 0 {
+		return nil
+	}
+
+	if templateOrDefault(settings.NamespaceTemplate, DefaultConfigMapNamespaceTemplate) != DefaultConfigMapNamespaceTemplate {
+		return errors.Errorf("configMap.namespaceTemplate (--config-map-namespace-template) %q can not be combined with namespaces %v, config maps have to be in the namespace of the cluster",
+			settings.NamespaceTemplate, s.Namespaces)
+	}
+	for _, namespace := range settings.AllowedNamespaces {
+		if strings.TrimSpace(namespace) != "" {
+			return errors.Errorf("configMap.allowedNamespaces (--config-map-allowed-namespaces) %v can not be combined with namespaces %v, config maps have to be in the namespace of the cluster",
+				settings.AllowedNamespaces, s.Namespaces)
+		}
+	}
+
+	return nil
+}
+
+// CacheOptions restricts the manager cache to the namespaces and the selected
+// clusters. Cluster scoped objects, like ProviderConfigs and
+// EnvironmentConfigs, are cached across the whole cluster. All namespaced
+// objects the operator reads, including the generated ConfigMaps, have to be
+// in one of the namespaces.
+func (s ClusterScope) CacheOptions() cache.Options {
+	options := cache.Options{}
+
+	if len(s.Namespaces) > 0 {
+		options.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range s.Namespaces {
+			options.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
+	if s.Selector != nil {
+		options.ByObject = map[client.Object]cache.ByObject{
+			&capi.Cluster{}: {Label: s.Selector},
+		}
+	}
+
+	return options
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ClusterScope", Label(unitLabel), func() {
+	newCluster := func(namespace string, labels map[string]string) *capi.Cluster {
+		return &capi.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: namespace,
+				Labels:    labels,
+			},
+		}
+	}
+
+	It("contains all clusters by default", func() {
+		scope, err := controllers.ParseClusterScope("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.Namespaces).To(BeEmpty())
+		Expect(scope.Selector).To(BeNil())
+		Expect(scope.Contains(newCluster("org-a", nil))).To(BeTrue())
+
+		options := scope.CacheOptions()
+		Expect(options.DefaultNamespaces).To(BeEmpty())
+		Expect(options.ByObject).To(BeEmpty())
+	})
+
+	It("parses namespaces", func() {
+		scope, err := controllers.ParseClusterScope("org-a, org-b,,org-a", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.Namespaces).To(Equal([]string{"org-a", "org-b"}))
+		Expect(scope.Contains(newCluster("org-b", nil))).To(BeTrue())
+		Expect(scope.Contains(newCluster("org-c", nil))).To(BeFalse())
+
+		options := scope.CacheOptions()
+		Expect(options.DefaultNamespaces).To(HaveLen(2))
+		Expect(options.DefaultNamespaces).To(HaveKey("org-a"))
+		Expect(options.DefaultNamespaces).To(HaveKey("org-b"))
+	})
+
+	It("rejects invalid namespaces", func() {
+		_, err := controllers.ParseClusterScope("Org_A", "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("parses the cluster selector", func() {
+		scope, err := controllers.ParseClusterScope("", "giantswarm.io/organization in (acme,example)")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.Contains(newCluster("org-a", map[string]string{"giantswarm.io/organization": "acme"}))).To(BeTrue())
+		Expect(scope.Contains(newCluster("org-a", map[string]string{"giantswarm.io/organization": "other"}))).To(BeFalse())
+		Expect(scope.Contains(newCluster("org-a", nil))).To(BeFalse())
+
+		options := scope.CacheOptions()
+		Expect(options.DefaultNamespaces).To(BeEmpty())
+		Expect(options.ByObject).To(HaveLen(1))
+		for object, byObject := range options.ByObject {
+			Expect(object).To(BeAssignableToTypeOf(&capi.Cluster{}))
+			Expect(byObject.Label.String()).To(Equal("giantswarm.io/organization in (acme,example)"))
+		}
+	})
+
+	It("only allows config maps in the namespace of the cluster with namespaces", func() {
+		scope, err := controllers.ParseClusterScope("org-a", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(scope.CheckConfigMapSettings(controllers.ConfigMapSettings{})).To(Succeed())
+		Expect(scope.CheckConfigMapSettings(controllers.ConfigMapSettings{
+			NamespaceTemplate: controllers.DefaultConfigMapNamespaceTemplate,
+			AllowedNamespaces: []string{""},
+		})).To(Succeed())
+		Expect(scope.CheckConfigMapSettings(controllers.ConfigMapSettings{
+			NamespaceTemplate: "crossplane",
+		})).To(MatchError(ContainSubstring("configMap.namespaceTemplate")))
+		Expect(scope.CheckConfigMapSettings(controllers.ConfigMapSettings{
+			AllowedNamespaces: []string{"crossplane"},
+		})).To(MatchError(ContainSubstring("configMap.allowedNamespaces")))
+
+		scope, err = controllers.ParseClusterScope("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.CheckConfigMapSettings(controllers.ConfigMapSettings{
+			NamespaceTemplate: "crossplane",
+			AllowedNamespaces: []string{"crossplane"},
+		})).To(Succeed())
+	})
+
+	It("rejects invalid cluster selectors", func() {
+		_, err := controllers.ParseClusterScope("", "giantswarm.io/organization in acme")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("requires both the namespace and the selector to match", func() {
+		scope, err := controllers.ParseClusterScope("org-a", "tier=gold")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scope.Contains(newCluster("org-a", map[string]string{"tier": "gold"}))).To(BeTrue())
+		Expect(scope.Contains(newCluster("org-b", map[string]string{"tier": "gold"}))).To(BeFalse())
+		Expect(scope.Contains(newCluster("org-a", map[string]string{"tier": "silver"}))).To(BeFalse())
+	})
+})
+
+var _ = Describe("ConfigMapReconciler scope", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		apiClient  client.Client
+		reconciler *controllers.ConfigMapReconciler
+		cluster    *capi.Cluster
+	)
+
+	reconcile := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	getCluster := func() *capi.Cluster {
+		current := &capi.Cluster{}
+		Expect(apiClient.Get(ctx, client.ObjectKeyFromObject(cluster), current)).To(Succeed())
+		return current
+	}
+
+	setOrganization := func(organization string) {
+		current := getCluster()
+		current.Labels = map[string]string{"giantswarm.io/organization": organization}
+		Expect(apiClient.Update(ctx, current)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster()
+		cluster.Labels = map[string]string{"giantswarm.io/organization": "acme"}
+		apiClient = newFakeManagementClient(objects...)
+
+		scope, err := controllers.ParseClusterScope("", "giantswarm.io/organization=acme")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Like the manager cache, the client only returns the selected clusters
+		cachedClient := interceptor.NewClient(apiClient.(client.WithWatch), interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				err := c.Get(ctx, key, obj, opts...)
+				if cluster, ok := obj.(*capi.Cluster); ok && err == nil && !scope.Contains(cluster) {
+					return k8serrors.NewNotFound(capi.GroupVersion.WithResource("clusters").GroupResource(), key.Name)
+				}
+				return err
+			},
+		})
+
+		reconciler = &controllers.ConfigMapReconciler{
+			Client:       cachedClient,
+			APIReader:    apiClient,
+			Scope:        scope,
+			BaseDomain:   "base.domain.io",
+			ProviderRole: "the-provider-role",
+		}
+
+		reconcile()
+	})
+
+	It("reconciles the selected cluster", func() {
+		Expect(controllerutil.ContainsFinalizer(getCluster(), controllers.Finalizer)).To(BeTrue())
+		configMap := &corev1.ConfigMap{}
+		Expect(apiClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)).To(Succeed())
+	})
+
+	When("the cluster leaves the selector", func() {
+		BeforeEach(func() {
+			setOrganization("other")
+			reconcile()
+		})
+
+		It("cleans up and removes the finalizer", func() {
+			Expect(controllerutil.ContainsFinalizer(getCluster(), controllers.Finalizer)).To(BeFalse())
+			configMap := &corev1.ConfigMap{}
+			err := apiClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("does not reconcile it again", func() {
+			reconcile()
+			Expect(controllerutil.ContainsFinalizer(getCluster(), controllers.Finalizer)).To(BeFalse())
+		})
+
+		It("reconciles it once it is selected again", func() {
+			setOrganization("acme")
+			reconcile()
+			Expect(controllerutil.ContainsFinalizer(getCluster(), controllers.Finalizer)).To(BeTrue())
+		})
+	})
+})
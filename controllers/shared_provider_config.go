@@ -0,0 +1,438 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SharedProviderConfigMode selects whether clusters in the same AWS account
+// share a ProviderConfig named after the account.
+type SharedProviderConfigMode string
+
+const (
+	// SharedProviderConfigDisabled only creates the ProviderConfigs of each
+	// cluster.
+	SharedProviderConfigDisabled SharedProviderConfigMode = "Disabled"
+	// SharedProviderConfigAlongside creates the shared ProviderConfig of the
+	// account in addition to the ProviderConfigs of each cluster.
+	SharedProviderConfigAlongside SharedProviderConfigMode = "Alongside"
+	// SharedProviderConfigInstead creates only the shared ProviderConfig of
+	// the account. The ProviderConfigs of the clusters and their variants are
+	// deleted.
+	SharedProviderConfigInstead SharedProviderConfigMode = "Instead"
+)
+
+const (
+	SharedProviderConfigNamePrefix = "account-"
+
+	// SharedProviderConfigLabel marks the shared ProviderConfigs. They are
+	// labelled with their account instead of a cluster, as they outlive
+	// single clusters.
+	SharedProviderConfigLabel = "crossplane-config-operator.giantswarm.io/shared-provider-config"
+
+	// ReferencedByAnnotation lists the clusters using a shared ProviderConfig
+	// as comma separated `namespace/name` pairs. The ProviderConfig is deleted
+	// once the list is empty.
+	ReferencedByAnnotation = "crossplane-config-operator.giantswarm.io/referenced-by"
+)
+
+var sharedProviderConfigModes = []SharedProviderConfigMode{
+	SharedProviderConfigDisabled,
+	SharedProviderConfigAlongside,
+	SharedProviderConfigInstead,
+}
+
+// ParseSharedProviderConfigMode parses a shared ProviderConfig mode. An empty
+// string disables shared ProviderConfigs.
+func ParseSharedProviderConfigMode(s string) (SharedProviderConfigMode, error) {
+	if s == "" {
+		return SharedProviderConfigDisabled, nil
+	}
+
+	for _, mode := range sharedProviderConfigModes {
+		if strings.EqualFold(s, string(mode)) {
+			return mode, nil
+		}
+	}
+
+	return "", errors.Errorf("unknown shared provider config mode %q, must be one of %v", s, sharedProviderConfigModes)
+}
+
+func (r *ConfigMapReconciler) sharedProviderConfigEnabled() bool {
+	return r.SharedProviderConfig != "" && r.SharedProviderConfig != SharedProviderConfigDisabled
+}
+
+func getSharedProviderConfigName(accountID string) string {
+	return SharedProviderConfigNamePrefix + accountID
+}
+
+// resolveSharedCredentials resolves the credentials of the shared
+// ProviderConfig of an account. They only depend on the operator
+// configuration and the account, so all clusters of the account render the
+// same spec. Cluster annotations are ignored and the provider role template
+// is rendered without .ClusterName, .Namespace and .Region, templates using
+// them are rejected when the operator config is loaded. A credentials secret
+// has to be given as `namespace/name`.
+func (r *ConfigMapReconciler) resolveSharedCredentials(accountID, region string) (providerCredentials, error) {
+	source := r.CredentialsSource
+	if source == "" {
+		source = CredentialsSourceWebIdentity
+	}
+
+	if source == CredentialsSourceSecret {
+		if !strings.Contains(r.CredentialsSecret, "/") {
+			return providerCredentials{}, errors.Errorf("credentials source %s of the shared provider config needs a secret in the form namespace/name, got %q",
+				CredentialsSourceSecret, r.CredentialsSecret)
+		}
+		secret, err := ParseCredentialsSecret(r.CredentialsSecret, "")
+		if err != nil {
+			return providerCredentials{}, errors.WithStack(err)
+		}
+
+		return providerCredentials{
+			Source:    source,
+			Secret:    secret,
+			SecretKey: templateOrDefault(r.CredentialsSecretKey, DefaultCredentialsSecretKey),
+		}, nil
+	}
+
+	roleARN, err := renderRoleARN(r.ProviderRole, roleTemplateData{
+		Partition: getPartition(region),
+		AccountID: accountID,
+	})
+	if err != nil {
+		return providerCredentials{}, errors.WithStack(err)
+	}
+
+	return providerCredentials{
+		Source:  source,
+		RoleARN: roleARN,
+	}, nil
+}
+
+// clusterRoleTemplateFields are the fields of the role template data that
+// differ between the clusters of an account.
+var clusterRoleTemplateFields = []string{"ClusterName", "Namespace", "Region"}
+
+// validateSharedRoleTemplate rejects provider role templates using data of a
+// single cluster, which the shared ProviderConfig of an account does not
+// have. The template is walked instead of rendered, so fields used only in
+// conditions are found as well.
+func validateSharedRoleTemplate(text string) error {
+	tmpl, err := template.New("provider role").Parse(text)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse provider role template")
+	}
+
+	var used []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, child := range node.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.IfNode:
+			walk(&node.BranchNode)
+		case *parse.RangeNode:
+			walk(&node.BranchNode)
+		case *parse.WithNode:
+			walk(&node.BranchNode)
+		case *parse.BranchNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.TemplateNode:
+			walk(node.Pipe)
+		case *parse.PipeNode:
+			if node == nil {
+				return
+			}
+			for _, cmd := range node.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(node.Node)
+			used = append(used, node.Field...)
+		case *parse.FieldNode:
+			used = append(used, node.Ident...)
+		case *parse.VariableNode:
+			used = append(used, node.Ident...)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+
+	for _, field := range clusterRoleTemplateFields {
+		if slices.Contains(used, field) {
+			return errors.Errorf("provider role %q of the shared provider config can not use .%s, it is shared by all clusters of the account", text, field)
+		}
+	}
+
+	return nil
+}
+
+// reconcileSharedProviderConfig creates the shared ProviderConfig of the
+// account of the cluster, or adds the cluster to its references. References
+// to other shared ProviderConfigs, e.g. after the account of the cluster
+// changed, are released.
+func (r *ConfigMapReconciler) reconcileSharedProviderConfig(ctx context.Context, cluster *capi.Cluster, clusterInfo *ClusterInfo, accountID string) error {
+	logger := log.FromContext(ctx)
+
+	mapping, err := r.getProviderConfigMapping(r.Client.RESTMapper())
+	if metaerr.IsNoMatchError(err) {
+		logger.Info("Provider config CRD not found, skipping shared provider config creation")
+		conditions.MarkFalse(cluster, SharedProviderConfigReadyCondition, ProviderConfigAPIUnavailableReason, capi.ConditionSeverityInfo,
+			"No supported ProviderConfig API is served, install provider-aws to create it")
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "Failed to discover provider config api")
+		return errors.WithStack(err)
+	}
+
+	providerConfig := getProviderConfig(mapping, clusterInfo.SharedProviderConfigName, cluster)
+	logger = logger.WithValues("providerConfig", providerConfig.GetName())
+	desiredSpec, err := getProviderConfigSpec(*clusterInfo.SharedCredentials, providerConfig.GetNamespace())
+	if err != nil {
+		logger.Error(err, "invalid shared provider config credentials")
+		conditions.MarkFalse(cluster, SharedProviderConfigReadyCondition, InvalidCredentialsReason, capi.ConditionSeverityError, "%s", err)
+		return nil
+	}
+	setEndpoint(desiredSpec, r.Endpoint)
+	reference := getClusterReference(cluster)
+
+	err = r.Client.Get(ctx, client.ObjectKeyFromObject(providerConfig), providerConfig)
+	if k8serrors.IsNotFound(err) {
+		logger.Info("Creating shared provider config")
+		setManaged(providerConfig)
+		setSharedLabels(providerConfig, accountID)
+		setReferences(providerConfig, []string{reference})
+		providerConfig.Object["spec"] = desiredSpec
+
+		// A concurrent create by another cluster of the account fails with
+		// AlreadyExists, the reconcile is retried and adds the reference
+		err = r.Client.Create(ctx, providerConfig)
+		if err != nil {
+			logger.Error(err, "failed to create shared provider config")
+			return errors.WithStack(err)
+		}
+	} else if err != nil {
+		logger.Error(err, "failed to get shared provider config")
+		return errors.WithStack(err)
+	} else if !isManaged(providerConfig) && !isAdoptable(providerConfig) {
+		logger.Info("shared provider config is not managed by the operator, refusing to update it")
+		conditions.MarkFalse(cluster, SharedProviderConfigReadyCondition, OwnershipConflictReason, capi.ConditionSeverityWarning,
+			"ProviderConfig %s is not managed by %s, annotate it with %s=true to adopt it",
+			providerConfig.GetName(), ManagedByValue, AdoptAnnotation)
+		return nil
+	} else {
+		references, err := r.pruneReferences(ctx, getReferences(providerConfig))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !slices.Contains(references, reference) {
+			references = append(references, reference)
+		}
+
+		updated := providerConfig.DeepCopy()
+		setManaged(updated)
+		setSharedLabels(updated, accountID)
+		setReferences(updated, references)
+		updated.Object["spec"] = desiredSpec
+
+		if !equality.Semantic.DeepEqual(updated.Object, providerConfig.Object) {
+			// Update instead of patch, the resource version guards the
+			// references against concurrent changes by other clusters
+			err = r.Client.Update(ctx, updated)
+			if err != nil {
+				logger.Error(err, "failed to update shared provider config")
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	conditions.MarkTrue(cluster, SharedProviderConfigReadyCondition)
+
+	return r.releaseSharedProviderConfigs(ctx, cluster, providerConfig)
+}
+
+// releaseSharedProviderConfigs removes the cluster from the references of all
+// shared ProviderConfigs except keep. Shared ProviderConfigs without
+// references left are deleted.
+func (r *ConfigMapReconciler) releaseSharedProviderConfigs(ctx context.Context, cluster *capi.Cluster, keep ...*unstructured.Unstructured) error {
+	logger := log.FromContext(ctx)
+	mapper := r.Client.RESTMapper()
+	reference := getClusterReference(cluster)
+
+	for _, gk := range providerConfigKinds {
+		mapping, err := mapper.RESTMapping(gk)
+		if metaerr.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		providerConfigs := &unstructured.UnstructuredList{}
+		providerConfigs.SetGroupVersionKind(mapping.GroupVersionKind.GroupVersion().WithKind(gk.Kind + "List"))
+		err = r.Client.List(ctx, providerConfigs, client.MatchingLabels{
+			ManagedByLabel:            ManagedByValue,
+			SharedProviderConfigLabel: "true",
+		})
+		if err != nil {
+			logger.Error(err, "failed to list shared provider configs", "kind", gk.Kind)
+			return errors.WithStack(err)
+		}
+
+		for i := range providerConfigs.Items {
+			providerConfig := &providerConfigs.Items[i]
+			if isSameObject(providerConfig, keep) {
+				continue
+			}
+
+			references := getReferences(providerConfig)
+			if !slices.Contains(references, reference) {
+				continue
+			}
+			references = slices.DeleteFunc(references, func(ref string) bool {
+				return ref == reference
+			})
+
+			if len(references) == 0 {
+				logger.Info("Deleting shared provider config", "kind", gk.Kind, "name", providerConfig.GetName())
+				// The precondition makes sure no other cluster started
+				// using it in the meantime
+				resourceVersion := providerConfig.GetResourceVersion()
+				err = r.Client.Delete(ctx, providerConfig, client.Preconditions{ResourceVersion: &resourceVersion})
+				if err != nil && !k8serrors.IsNotFound(err) {
+					logger.Error(err, "failed to delete shared provider config", "kind", gk.Kind)
+					return errors.WithStack(err)
+				}
+				continue
+			}
+
+			logger.Info("Releasing shared provider config", "kind", gk.Kind, "name", providerConfig.GetName())
+			setReferences(providerConfig, references)
+			err = r.Client.Update(ctx, providerConfig)
+			if err != nil {
+				logger.Error(err, "failed to update shared provider config", "kind", gk.Kind)
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// pruneReferences drops references to clusters that no longer exist, e.g.
+// because their finalizer was removed by hand. References to clusters outside
+// the scope of this instance are kept, the cache can not tell whether they
+// exist.
+func (r *ConfigMapReconciler) pruneReferences(ctx context.Context, references []string) ([]string, error) {
+	pruned := []string{}
+	for _, reference := range references {
+		namespace, name, _ := strings.Cut(reference, "/")
+		if !r.Scope.isObservable(namespace) {
+			pruned = append(pruned, reference)
+			continue
+		}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &capi.Cluster{})
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pruned = append(pruned, reference)
+	}
+
+	return pruned, nil
+}
+
+func getClusterReference(cluster *capi.Cluster) string {
+	return cluster.Namespace + "/" + cluster.Name
+}
+
+func getReferences(providerConfig *unstructured.Unstructured) []string {
+	value := providerConfig.GetAnnotations()[ReferencedByAnnotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func setReferences(providerConfig *unstructured.Unstructured, references []string) {
+	references = slices.Clone(references)
+	sort.Strings(references)
+
+	annotations := providerConfig.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ReferencedByAnnotation] = strings.Join(references, ",")
+	providerConfig.SetAnnotations(annotations)
+}
+
+func setSharedLabels(providerConfig *unstructured.Unstructured, accountID string) {
+	labels := providerConfig.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[SharedProviderConfigLabel] = "true"
+	labels[AccountIDLabel] = accountID
+	providerConfig.SetLabels(labels)
+}
+
+func isSameObject(object *unstructured.Unstructured, objects []*unstructured.Unstructured) bool {
+	for _, other := range objects {
+		if object.GroupVersionKind().GroupKind() == other.GroupVersionKind().GroupKind() &&
+			object.GetNamespace() == other.GetNamespace() && object.GetName() == other.GetName() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("ConfigMapReconciler shared provider configs", Label(unitLabel), func() {
+	var (
+		ctx context.Context
+
+		fakeClient   client.Client
+		reconciler   *controllers.ConfigMapReconciler
+		cluster      *capi.Cluster
+		otherCluster *capi.Cluster
+	)
+
+	getProviderConfig := func(name string) (*unstructured.Unstructured, error) {
+		providerConfig := &unstructured.Unstructured{}
+		providerConfig.SetAPIVersion("aws.upbound.io/v1beta1")
+		providerConfig.SetKind("ProviderConfig")
+		err := fakeClient.Get(ctx, types.NamespacedName{Name: name}, providerConfig)
+		return providerConfig, err
+	}
+
+	getReferences := func() string {
+		providerConfig, err := getProviderConfig("account-123456789012")
+		Expect(err).NotTo(HaveOccurred())
+		return providerConfig.GetAnnotations()[controllers.ReferencedByAnnotation]
+	}
+
+	reconcile := func(cluster *capi.Cluster) {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cluster)})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	deleteCluster := func(cluster *capi.Cluster) {
+		Expect(fakeClient.Delete(ctx, cluster)).To(Succeed())
+		reconcile(cluster)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var objects []client.Object
+		cluster, objects = newFakeCapaCluster()
+
+		// A second cluster of the account in another namespace
+		otherCluster = cluster.DeepCopy()
+		otherCluster.Name = "other"
+		otherCluster.Namespace = "org-other"
+		otherCluster.Spec.InfrastructureRef.Name = "other"
+		otherAWSCluster := objects[1].(*capa.AWSCluster).DeepCopy()
+		otherAWSCluster.Name = "other"
+		otherAWSCluster.Namespace = "org-other"
+		otherIdentity := objects[2].(*capa.AWSClusterRoleIdentity).DeepCopy()
+		otherIdentity.Namespace = "org-other"
+		objects = append(objects, otherCluster, otherAWSCluster, otherIdentity)
+
+		fakeClient = newFakeManagementClient(objects...)
+		reconciler = &controllers.ConfigMapReconciler{
+			Client:               fakeClient,
+			BaseDomain:           "base.domain.io",
+			ProviderRole:         "the-provider-role",
+			SharedProviderConfig: controllers.SharedProviderConfigAlongside,
+		}
+
+		reconcile(cluster)
+	})
+
+	It("creates the shared provider config next to the one of the cluster", func() {
+		providerConfig, err := getProviderConfig("account-123456789012")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(providerConfig.GetLabels()).To(HaveKeyWithValue(controllers.AccountIDLabel, "123456789012"))
+		Expect(getReferences()).To(Equal("org-acme/acme"))
+
+		_, err = getProviderConfig("acme")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("references every cluster of the account once", func() {
+		reconcile(otherCluster)
+		reconcile(cluster)
+		reconcile(otherCluster)
+
+		Expect(getReferences()).To(Equal("org-acme/acme,org-other/other"))
+	})
+
+	It("keeps the shared provider config until the last cluster is deleted", func() {
+		reconcile(otherCluster)
+
+		deleteCluster(cluster)
+		Expect(getReferences()).To(Equal("org-other/other"))
+
+		deleteCluster(otherCluster)
+		_, err := getProviderConfig("account-123456789012")
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("releases the shared provider config when the account of a cluster changes", func() {
+		reconcile(otherCluster)
+
+		patched := otherCluster.DeepCopy()
+		Expect(fakeClient.Get(ctx, client.ObjectKeyFromObject(otherCluster), patched)).To(Succeed())
+		patched.Annotations = map[string]string{controllers.AccountIDAnnotation: "210987654321"}
+		Expect(fakeClient.Update(ctx, patched)).To(Succeed())
+		reconcile(otherCluster)
+
+		Expect(getReferences()).To(Equal("org-acme/acme"))
+		providerConfig, err := getProviderConfig("account-210987654321")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(providerConfig.GetAnnotations()).To(HaveKeyWithValue(controllers.ReferencedByAnnotation, "org-other/other"))
+	})
+
+	When("the shared provider config is used instead", func() {
+		BeforeEach(func() {
+			reconciler.SharedProviderConfig = controllers.SharedProviderConfigInstead
+			reconcile(cluster)
+		})
+
+		It("deletes the provider config of the cluster", func() {
+			_, err := getProviderConfig("acme")
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+			Expect(getReferences()).To(Equal("org-acme/acme"))
+		})
+	})
+
+	When("shared provider configs are disabled again", func() {
+		BeforeEach(func() {
+			reconcile(otherCluster)
+			reconciler.SharedProviderConfig = controllers.SharedProviderConfigDisabled
+			reconcile(cluster)
+		})
+
+		It("deletes the shared provider config once no cluster uses it", func() {
+			Expect(getReferences()).To(Equal("org-other/other"))
+
+			reconcile(otherCluster)
+			_, err := getProviderConfig("account-123456789012")
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
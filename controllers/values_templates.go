@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	sprig "github.com/go-task/slim-sprig/v3"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+// ValuesKey is the config map key holding the built-in values.
+const ValuesKey = "values"
+
+// valuesTemplateData is the data the user supplied values templates are
+// rendered with.
+type valuesTemplateData struct {
+	// The resolved cluster information and the built-in values as written to
+	// the `values` key.
+	ClusterInfo *ClusterInfo
+	Values      crossplaneConfigValues
+
+	// The raw objects the cluster information was resolved from. Only one of
+	// AWSCluster, AWSManagedControlPlane and ROSAControlPlane is set.
+	Cluster                *capi.Cluster
+	AWSCluster             *capa.AWSCluster
+	AWSManagedControlPlane *eks.AWSManagedControlPlane
+	ROSAControlPlane       *rosa.ROSAControlPlane
+}
+
+// LoadValuesTemplates reads one template per file from dir. The file name is
+// used as config map key. Hidden files, like the ones kubelet creates when
+// mounting a ConfigMap, are ignored.
+func LoadValuesTemplates(dir string) (map[string]*template.Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	templates := map[string]*template.Template{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+
+		text, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		templates[entry.Name()], err = ParseValuesTemplate(entry.Name(), string(text))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return templates, nil
+}
+
+// ParseValuesTemplate parses the template for the given config map key.
+func ParseValuesTemplate(key, text string) (*template.Template, error) {
+	if key == ValuesKey {
+		return nil, errors.Errorf("values template key %q is reserved for the built-in values", key)
+	}
+	if msgs := validation.IsConfigMapKey(key); len(msgs) > 0 {
+		return nil, errors.Errorf("invalid values template key %q: %s", key, strings.Join(msgs, ", "))
+	}
+
+	tmpl, err := template.New(key).
+		Option("missingkey=error").
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(template.FuncMap{"toYaml": toYaml}).
+		Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse values template %q", key)
+	}
+
+	return tmpl, nil
+}
+
+// renderValuesTemplates renders every template independently. Keys failing to
+// render are returned separately, so they do not affect the other keys.
+func renderValuesTemplates(templates map[string]*template.Template, data valuesTemplateData) (map[string]string, map[string]error) {
+	rendered := map[string]string{}
+	failed := map[string]error{}
+
+	for key, tmpl := range templates {
+		var out bytes.Buffer
+		err := tmpl.Execute(&out, data)
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+		rendered[key] = out.String()
+	}
+
+	return rendered, failed
+}
+
+func failedKeys(failed map[string]error) []string {
+	keys := make([]string, 0, len(failed))
+	for key := range failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toYaml(v interface{}) (string, error) {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("LoadValuesTemplates", Label(unitLabel), func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("loads one template per file", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "vpc"), []byte("{{ .Values.AWSCluster.VpcID }}"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "account.yaml"), []byte("{{ .Values.AccountID | quote }}"), 0o600)).To(Succeed())
+
+		templates, err := controllers.LoadValuesTemplates(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(templates).To(HaveLen(2))
+		Expect(templates).To(HaveKey("vpc"))
+		Expect(templates).To(HaveKey("account.yaml"))
+	})
+
+	It("ignores hidden files and directories", func() {
+		Expect(os.Mkdir(filepath.Join(dir, "..data"), 0o700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, ".hidden"), []byte("{{ broken"), 0o600)).To(Succeed())
+
+		templates, err := controllers.LoadValuesTemplates(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(templates).To(BeEmpty())
+	})
+
+	It("rejects templates that do not parse", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "broken"), []byte("{{ .Values"), 0o600)).To(Succeed())
+
+		_, err := controllers.LoadValuesTemplates(dir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects a template for the built-in values key", func() {
+		Expect(os.WriteFile(filepath.Join(dir, controllers.ValuesKey), []byte("foo"), 0o600)).To(Succeed())
+
+		_, err := controllers.LoadValuesTemplates(dir)
+		Expect(err).To(HaveOccurred())
+	})
+})
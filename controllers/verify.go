@@ -0,0 +1,262 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DriftType classifies a difference found by Verify.
+type DriftType string
+
+const (
+	// DriftChanged is a generated object differing from the computed one,
+	// e.g. a hand-edited ConfigMap.
+	DriftChanged DriftType = "Changed"
+	// DriftMissing is a generated object that does not exist.
+	DriftMissing DriftType = "Missing"
+	// DriftOrphaned is a generated object the operator would delete, e.g.
+	// under an old name or of a cluster that no longer exists.
+	DriftOrphaned DriftType = "Orphaned"
+	// DriftFinalizer is a missing or leftover finalizer on a Cluster or a
+	// legacy finalizer on an AWSCluster.
+	DriftFinalizer DriftType = "Finalizer"
+)
+
+// Drift is a difference between the live objects and the outputs the operator
+// computes for a cluster.
+type Drift struct {
+	// Cluster is the namespace/name of the cluster.
+	Cluster string    `json:"cluster"`
+	Type    DriftType `json:"type"`
+	Kind    string    `json:"kind"`
+	// Object is the namespace/name of the object.
+	Object string `json:"object"`
+	// Fields are the changed fields of the object besides the finalizers.
+	Fields  []string `json:"fields,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// Verify computes the outputs of all clusters in scope from the live objects
+// and returns where the live objects differ, without writing anything. The
+// reconciler runs with the dry run client, so the same code decides what the
+// outputs are. Clusters being deleted are skipped. Writes to the status of
+// the clusters are not drift.
+func Verify(ctx context.Context, c client.Client, config OperatorConfig, scope ClusterScope) ([]Drift, error) {
+	logger := log.FromContext(ctx)
+
+	reconciler := &ConfigMapReconciler{Client: NewDryRunClient(c, nil), Scope: scope}
+	err := reconciler.ApplyOperatorConfig(config)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	clusters := []capi.Cluster{}
+	for _, namespace := range scope.listNamespaces() {
+		list := &capi.ClusterList{}
+		err = c.List(ctx, list, client.InNamespace(namespace))
+		if err != nil {
+			logger.Error(err, "failed to list clusters")
+			return nil, errors.WithStack(err)
+		}
+		clusters = append(clusters, list.Items...)
+	}
+
+	drifts := []Drift{}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if !scope.Contains(cluster) || !isManagedCluster(cluster) || !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+		key := client.ObjectKeyFromObject(cluster)
+
+		reportCtx, report := startDryRunReport(log.IntoContext(ctx, logger.WithValues("Cluster", key)), key)
+		_, err = reconciler.Reconcile(reportCtx, ctrl.Request{NamespacedName: key})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to compute the outputs of cluster %s", key)
+		}
+		for _, change := range report.getChanges() {
+			if change.Status {
+				continue
+			}
+			drifts = append(drifts, getDrift(key, change))
+		}
+	}
+
+	orphans, err := getOrphanedObjects(ctx, c, scope)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	drifts = append(drifts, orphans...)
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		a, b := drifts[i], drifts[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Object < b.Object
+	})
+
+	return drifts, nil
+}
+
+// getDrift classifies a write the reconciler would make.
+func getDrift(cluster types.NamespacedName, change pendingChange) Drift {
+	drift := Drift{
+		Cluster: cluster.String(),
+		Kind:    change.Kind,
+		Object:  change.Object,
+	}
+
+	switch change.Verb {
+	case "create":
+		drift.Type = DriftMissing
+		return drift
+	case "delete", "delete all of":
+		drift.Type = DriftOrphaned
+		drift.Message = "not generated for the cluster anymore"
+		return drift
+	}
+
+	drift.Type = DriftChanged
+	for _, fieldChange := range change.Changes {
+		if fieldChange.Path != "metadata.finalizers" {
+			drift.Fields = append(drift.Fields, fieldChange.Path)
+			continue
+		}
+		drift.Type = DriftFinalizer
+		if containsFinalizer(fieldChange.New) {
+			drift.Message = fmt.Sprintf("finalizer %s is missing", Finalizer)
+		} else if change.Kind == "AWSCluster" {
+			drift.Message = fmt.Sprintf("legacy finalizer %s, the finalizer belongs on the Cluster", Finalizer)
+		} else {
+			drift.Message = fmt.Sprintf("finalizer %s is left over", Finalizer)
+		}
+	}
+
+	return drift
+}
+
+func containsFinalizer(finalizers interface{}) bool {
+	list, _ := finalizers.([]interface{})
+	for _, finalizer := range list {
+		if finalizer == Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// getOrphanedObjects returns the generated objects whose cluster does not
+// exist anymore, e.g. after a cluster was deleted while the operator was not
+// running. Objects of clusters outside the namespaces of the scope are left
+// out. As the cluster is gone, the label selector of the scope can not be
+// applied.
+func getOrphanedObjects(ctx context.Context, c client.Client, scope ClusterScope) ([]Drift, error) {
+	logger := log.FromContext(ctx)
+
+	gvks := []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}}
+	gvks = append(gvks, workloadProviderConfigGVKs...)
+	for _, gk := range append([]schema.GroupKind{environmentConfigKind}, providerConfigKinds...) {
+		mapping, err := c.RESTMapper().RESTMapping(gk)
+		if metaerr.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		gvks = append(gvks, mapping.GroupVersionKind)
+	}
+
+	clusterExists := map[types.NamespacedName]bool{}
+	drifts := []Drift{}
+	for _, gvk := range gvks {
+		// Cluster scoped objects are returned for every namespace
+		seen := map[types.NamespacedName]bool{}
+		objects := []unstructured.Unstructured{}
+		for _, namespace := range scope.listNamespaces() {
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			err := c.List(ctx, list, client.InNamespace(namespace),
+				client.MatchingLabels{ManagedByLabel: ManagedByValue}, client.HasLabels{ClusterNameLabel, ClusterNamespaceLabel})
+			if metaerr.IsNoMatchError(err) {
+				break
+			}
+			if err != nil {
+				logger.Error(err, "failed to list objects", "kind", gvk.Kind)
+				return nil, errors.WithStack(err)
+			}
+			for _, object := range list.Items {
+				if !seen[client.ObjectKeyFromObject(&object)] {
+					seen[client.ObjectKeyFromObject(&object)] = true
+					objects = append(objects, object)
+				}
+			}
+		}
+
+		for i := range objects {
+			object := &objects[i]
+			cluster := types.NamespacedName{
+				Namespace: object.GetLabels()[ClusterNamespaceLabel],
+				Name:      object.GetLabels()[ClusterNameLabel],
+			}
+			if !scope.containsNamespace(cluster.Namespace) {
+				continue
+			}
+
+			exists, ok := clusterExists[cluster]
+			if !ok {
+				err := c.Get(ctx, cluster, &capi.Cluster{})
+				if err != nil && !k8serrors.IsNotFound(err) {
+					return nil, errors.WithStack(err)
+				}
+				exists = err == nil
+				clusterExists[cluster] = exists
+			}
+			if exists {
+				continue
+			}
+
+			drifts = append(drifts, Drift{
+				Cluster: cluster.String(),
+				Type:    DriftOrphaned,
+				Kind:    gvk.Kind,
+				Object:  strings.TrimPrefix(client.ObjectKeyFromObject(object).String(), "/"),
+				Message: "the cluster does not exist",
+			})
+		}
+	}
+
+	return drifts, nil
+}
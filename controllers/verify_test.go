@@ -0,0 +1,257 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+var _ = Describe("Verify", Label(unitLabel), func() {
+	var (
+		ctx        context.Context
+		fakeClient client.Client
+		config     controllers.OperatorConfig
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(capi.AddToScheme(scheme)).To(Succeed())
+		Expect(capa.AddToScheme(scheme)).To(Succeed())
+
+		var err error
+		config, err = controllers.LoadOperatorConfig(filepath.Join("testdata", "render", "capa", "config.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// The live objects are the input of the render golden file with the
+		// outputs the operator wrote for it
+		objects := []client.Object{}
+		for _, name := range []string{"input.yaml", "output.yaml"} {
+			file, err := os.Open(filepath.Join("testdata", "render", "capa", name))
+			Expect(err).NotTo(HaveOccurred())
+			manifests, err := controllers.ReadManifests(file)
+			Expect(file.Close()).To(Succeed())
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, manifest := range manifests {
+				switch manifest.GetKind() {
+				case "Cluster":
+					manifest.SetFinalizers([]string{controllers.Finalizer})
+				case "AWSClusterRoleIdentity":
+					// The fake client does not ignore the namespace of
+					// cluster scoped objects
+					manifest.SetNamespace("org-acme")
+				}
+				objects = append(objects, manifest)
+			}
+		}
+
+		providerConfigGVK := schema.GroupVersionKind{Group: "aws.upbound.io", Version: "v1beta1", Kind: "ProviderConfig"}
+		mapper := metaerr.NewDefaultRESTMapper([]schema.GroupVersion{providerConfigGVK.GroupVersion()})
+		mapper.Add(providerConfigGVK, metaerr.RESTScopeRoot)
+
+		fakeClient = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRESTMapper(mapper).
+			WithObjects(objects...).
+			WithStatusSubresource(&capi.Cluster{}).
+			Build()
+	})
+
+	verify := func() []controllers.Drift {
+		drifts, err := controllers.Verify(ctx, fakeClient, config, controllers.ClusterScope{})
+		Expect(err).NotTo(HaveOccurred())
+		return drifts
+	}
+
+	It("finds no drift when the outputs are up to date", func() {
+		Expect(verify()).To(BeEmpty())
+	})
+
+	It("reports changed objects", func() {
+		configMap := &corev1.ConfigMap{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)).To(Succeed())
+		configMap.Data["values"] = "accountID: \"000000000000\"\n"
+		Expect(fakeClient.Update(ctx, configMap)).To(Succeed())
+
+		Expect(verify()).To(ConsistOf(controllers.Drift{
+			Cluster: "org-acme/acme",
+			Type:    controllers.DriftChanged,
+			Kind:    "ConfigMap",
+			Object:  "org-acme/acme-crossplane-config",
+			Fields:  []string{"data.values"},
+		}))
+	})
+
+	It("reports missing objects", func() {
+		providerConfig := &unstructured.Unstructured{}
+		providerConfig.SetAPIVersion("aws.upbound.io/v1beta1")
+		providerConfig.SetKind("ProviderConfig")
+		providerConfig.SetName("acme")
+		Expect(fakeClient.Delete(ctx, providerConfig)).To(Succeed())
+
+		Expect(verify()).To(ConsistOf(controllers.Drift{
+			Cluster: "org-acme/acme",
+			Type:    controllers.DriftMissing,
+			Kind:    "ProviderConfig",
+			Object:  "acme",
+		}))
+	})
+
+	It("reports objects of clusters that do not exist", func() {
+		Expect(fakeClient.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "gone-crossplane-config",
+				Namespace: "org-acme",
+				Labels: map[string]string{
+					controllers.ManagedByLabel:        controllers.ManagedByValue,
+					controllers.ClusterNameLabel:      "gone",
+					controllers.ClusterNamespaceLabel: "org-acme",
+				},
+			},
+		})).To(Succeed())
+
+		drifts := verify()
+		Expect(drifts).To(HaveLen(1))
+		Expect(drifts[0].Cluster).To(Equal("org-acme/gone"))
+		Expect(drifts[0].Type).To(Equal(controllers.DriftOrphaned))
+		Expect(drifts[0].Object).To(Equal("org-acme/gone-crossplane-config"))
+
+		drifts, err := controllers.Verify(ctx, fakeClient, config, controllers.ClusterScope{Namespaces: []string{"org-acme"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(HaveLen(1))
+
+		drifts, err = controllers.Verify(ctx, fakeClient, config, controllers.ClusterScope{Namespaces: []string{"org-other"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(BeEmpty())
+	})
+
+	It("reports missing and legacy finalizers", func() {
+		cluster := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, cluster)).To(Succeed())
+		cluster.Finalizers = nil
+		Expect(fakeClient.Update(ctx, cluster)).To(Succeed())
+
+		awsCluster := &capa.AWSCluster{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, awsCluster)).To(Succeed())
+		awsCluster.Finalizers = []string{controllers.Finalizer}
+		Expect(fakeClient.Update(ctx, awsCluster)).To(Succeed())
+
+		drifts := verify()
+		Expect(drifts).To(HaveLen(2))
+		Expect(drifts[0].Kind).To(Equal("AWSCluster"))
+		Expect(drifts[0].Type).To(Equal(controllers.DriftFinalizer))
+		Expect(drifts[1].Kind).To(Equal("Cluster"))
+		Expect(drifts[1].Type).To(Equal(controllers.DriftFinalizer))
+		Expect(drifts[1].Message).To(ContainSubstring("is missing"))
+
+		// Nothing was written
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, cluster)).To(Succeed())
+		Expect(cluster.Finalizers).To(BeEmpty())
+	})
+
+	It("migrates the legacy finalizer on reconcile", func() {
+		awsCluster := &capa.AWSCluster{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, awsCluster)).To(Succeed())
+		awsCluster.Finalizers = []string{controllers.Finalizer}
+		Expect(fakeClient.Update(ctx, awsCluster)).To(Succeed())
+
+		drifts := verify()
+		Expect(drifts).To(HaveLen(1))
+		Expect(drifts[0].Message).To(ContainSubstring("legacy finalizer"))
+
+		reconciler := &controllers.ConfigMapReconciler{Client: fakeClient}
+		Expect(reconciler.ApplyOperatorConfig(config)).To(Succeed())
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "org-acme", Name: "acme"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, awsCluster)).To(Succeed())
+		Expect(awsCluster.Finalizers).To(BeEmpty())
+		Expect(verify()).To(BeEmpty())
+	})
+
+	It("reports fields missing from the live objects with a client not resetting the object it reads into", func() {
+		cluster := &capi.Cluster{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme"}, cluster)).To(Succeed())
+		cluster.Finalizers = nil
+		Expect(fakeClient.Update(ctx, cluster)).To(Succeed())
+
+		configMap := &corev1.ConfigMap{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "org-acme", Name: "acme-crossplane-config"}, configMap)).To(Succeed())
+		delete(configMap.Labels, controllers.RegionLabel)
+		configMap.Data = nil
+		Expect(fakeClient.Update(ctx, configMap)).To(Succeed())
+
+		// Like a client decoding into the existing maps and fields of obj
+		mergingClient := interceptor.NewClient(fakeClient.(client.WithWatch), interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				live, ok := obj.DeepCopyObject().(client.Object)
+				Expect(ok).To(BeTrue())
+				err := c.Get(ctx, key, live, opts...)
+				if err != nil {
+					return err
+				}
+				data, err := json.Marshal(live)
+				Expect(err).NotTo(HaveOccurred())
+				return json.Unmarshal(data, obj)
+			},
+		})
+
+		drifts, err := controllers.Verify(ctx, mergingClient, config, controllers.ClusterScope{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(ConsistOf(
+			controllers.Drift{
+				Cluster: "org-acme/acme",
+				Type:    controllers.DriftFinalizer,
+				Kind:    "Cluster",
+				Object:  "org-acme/acme",
+				Message: "finalizer " + controllers.Finalizer + " is missing",
+			},
+			controllers.Drift{
+				Cluster: "org-acme/acme",
+				Type:    controllers.DriftChanged,
+				Kind:    "ConfigMap",
+				Object:  "org-acme/acme-crossplane-config",
+				Fields:  []string{"data", "metadata.labels[" + controllers.RegionLabel + "]"},
+			},
+		))
+	})
+})
@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metaerr "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// workloadProviderConfigGVKs are the ProviderConfigs of crossplane providers
+// talking to the workload cluster itself. They all authenticate with the
+// kubeconfig secret CAPI creates for the cluster.
+var workloadProviderConfigGVKs = []schema.GroupVersionKind{
+	{
+		Group:   "kubernetes.crossplane.io",
+		Kind:    "ProviderConfig",
+		Version: "v1alpha1",
+	},
+	{
+		Group:   "helm.crossplane.io",
+		Kind:    "ProviderConfig",
+		Version: "v1beta1",
+	},
+}
+
+// reconcileWorkloadProviderConfigs maintains the provider-kubernetes and
+// provider-helm ProviderConfigs of the cluster. They share the name of the
+// AWS ProviderConfig, so compositions can use the same providerConfigRef for
+// all providers.
+func (r *ConfigMapReconciler) reconcileWorkloadProviderConfigs(ctx context.Context, cluster *capi.Cluster, clusterInfo *ClusterInfo, name string) error {
+	logger := log.FromContext(ctx)
+
+	// The kubeconfig secret only works once the API server is up
+	if !conditions.IsTrue(cluster, capi.ControlPlaneInitializedCondition) {
+		logger.Info("Control plane not initialized yet, skipping workload provider configs")
+		conditions.MarkFalse(cluster, WorkloadProviderConfigsReadyCondition, ControlPlaneNotInitializedReason, capi.ConditionSeverityInfo,
+			"Waiting for the control plane to be initialized")
+		return nil
+	}
+
+	conflicts := []string{}
+	for _, gvk := range workloadProviderConfigGVKs {
+		providerConfig := &unstructured.Unstructured{}
+		providerConfig.SetGroupVersionKind(gvk)
+		err := r.Client.Get(ctx, types.NamespacedName{Name: name}, providerConfig)
+		if metaerr.IsNoMatchError(err) {
+			logger.Info("Provider config CRD not found, skipping provider config creation", "group", gvk.Group)
+			continue
+		}
+		if k8serrors.IsNotFound(err) {
+			logger.Info("Creating provider config", "group", gvk.Group)
+			providerConfig.SetName(name)
+			setManaged(providerConfig)
+			setClusterLabels(providerConfig, cluster.Name, cluster.Namespace)
+			setPropagatedMetadata(providerConfig, clusterInfo.Metadata)
+			providerConfig.Object["spec"] = getWorkloadProviderConfigSpec(cluster)
+
+			err = r.Client.Create(ctx, providerConfig)
+			if err != nil {
+				logger.Error(err, "failed to create provider config", "group", gvk.Group)
+				return errors.WithStack(err)
+			}
+		} else if err != nil {
+			logger.Error(err, "failed to get provider config", "group", gvk.Group)
+			return errors.WithStack(err)
+		} else if !isManaged(providerConfig) && !isAdoptable(providerConfig) {
+			logger.Info("provider config is not managed by the operator, refusing to update it", "group", gvk.Group)
+			conflicts = append(conflicts, fmt.Sprintf("%s %s", gvk.GroupKind(), name))
+			continue
+		} else {
+			patched := providerConfig.DeepCopy()
+			setManaged(patched)
+			setClusterLabels(patched, cluster.Name, cluster.Namespace)
+			setPropagatedMetadata(patched, clusterInfo.Metadata)
+			patched.Object["spec"] = getWorkloadProviderConfigSpec(cluster)
+			err = r.Client.Patch(ctx, patched, client.MergeFrom(providerConfig))
+			if err != nil {
+				logger.Error(err, "failed to patch provider config", "group", gvk.Group)
+				return errors.WithStack(err)
+			}
+		}
+
+		err = r.deleteManagedObjects(ctx, gvk, cluster, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		conditions.MarkFalse(cluster, WorkloadProviderConfigsReadyCondition, OwnershipConflictReason, capi.ConditionSeverityWarning,
+			"%v not managed by %s, annotate them with %s=true to adopt them", conflicts, ManagedByValue, AdoptAnnotation)
+		return nil
+	}
+	conditions.MarkTrue(cluster, WorkloadProviderConfigsReadyCondition)
+
+	return nil
+}
+
+func (r *ConfigMapReconciler) deleteWorkloadProviderConfigs(ctx context.Context, cluster *capi.Cluster) error {
+	for _, gvk := range workloadProviderConfigGVKs {
+		err := r.deleteManagedObjects(ctx, gvk, cluster)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func getWorkloadProviderConfigSpec(cluster *capi.Cluster) map[string]interface{} {
+	return map[string]interface{}{
+		"credentials": map[string]interface{}{
+			"source": "Secret",
+			"secretRef": map[string]interface{}{
+				"namespace": cluster.Namespace,
+				"name":      fmt.Sprintf("%s-kubeconfig", cluster.Name),
+				"key":       "value",
+			},
+		},
+	}
+}
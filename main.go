@@ -19,6 +19,8 @@ package main
 import (
 	"flag"
 	"os"
+	"slices"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -26,15 +28,18 @@ import (
 	"go.uber.org/zap/zapcore"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	capa "sigs.k8s.io/cluster-api-provider-aws/v2/api/v1beta2"
 	eks "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/eks/api/v1beta2"
+	rosa "sigs.k8s.io/cluster-api-provider-aws/v2/controlplane/rosa/api/v1beta2"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
 	// +kubebuilder:scaffold:imports
@@ -47,26 +52,101 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	utilruntime.Must(capi.AddToScheme(scheme))
 	utilruntime.Must(capa.AddToScheme(scheme))
 	utilruntime.Must(eks.AddToScheme(scheme))
+	utilruntime.Must(rosa.AddToScheme(scheme))
 
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(render(os.Args[2:]))
+		case "verify":
+			os.Exit(verify(os.Args[2:]))
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var providerRoleARN string
 	var baseDomain string
+	var configMapNameTemplate string
+	var configMapNamespaceTemplate string
+	var configMapAllowedNamespaces string
+	var providerConfigNameTemplate string
+	var environmentConfigNameTemplate string
+	var valuesTemplatesDir string
+	var providerConfigAPI string
+	var credentialsSource string
+	var credentialsSecret string
+	var credentialsSecretKey string
+	var providerConfigVariants string
+	var sharedProviderConfig string
+	var endpoint string
+	var propagateLabels string
+	var propagateAnnotations string
+	var outputFormats string
+	var namespaces string
+	var clusterSelector string
+	var leaderElectionID string
+	var configPath string
+	var dryRun bool
+	flag.StringVar(&configPath, "config", "",
+		"Path of the operator config file. It replaces the settings flags and is reloaded when it changes.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Log, report as events and count in the pending_changes metric what would change instead of writing it.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&providerRoleARN, "provider-role", "", "The role used by the aws crossplane provider.")
+	flag.StringVar(&providerRoleARN, "provider-role", "", "The role used by the aws crossplane provider. A Go template for a role ARN or a role name in the cluster account, "+
+		"with .Partition, .AccountID, .ClusterName, .Namespace and .Region.")
 	flag.StringVar(&baseDomain, "base-domain", "", "Management cluster base domain.")
+	flag.StringVar(&configMapNameTemplate, "config-map-name-template", controllers.DefaultConfigMapNameTemplate,
+		"Go template for the name of the generated config map.")
+	flag.StringVar(&configMapNamespaceTemplate, "config-map-namespace-template", controllers.DefaultConfigMapNamespaceTemplate,
+		"Go template for the namespace of the generated config map.")
+	flag.StringVar(&configMapAllowedNamespaces, "config-map-allowed-namespaces", "",
+		"Comma separated namespaces besides the cluster namespace the config map namespace annotation of a cluster may select.")
+	flag.StringVar(&providerConfigNameTemplate, "provider-config-name-template", controllers.DefaultProviderConfigNameTemplate,
+		"Go template for the name of the generated provider config.")
+	flag.StringVar(&environmentConfigNameTemplate, "environment-config-name-template", controllers.DefaultEnvironmentConfigNameTemplate,
+		"Go template for the name of the generated environment config.")
+	flag.StringVar(&providerConfigAPI, "provider-config-api", "",
+		"ProviderConfig kind to create as Kind.group or Kind.version.group, e.g. ClusterProviderConfig.aws.m.upbound.io. Discovered when empty.")
+	flag.StringVar(&credentialsSource, "credentials-source", string(controllers.CredentialsSourceWebIdentity),
+		"Credentials source of the generated provider configs: WebIdentity, IRSA, PodIdentity or Secret.")
+	flag.StringVar(&credentialsSecret, "credentials-secret", "",
+		"Secret with the provider credentials for the Secret credentials source, as name or namespace/name. A bare name refers to the cluster namespace.")
+	flag.StringVar(&credentialsSecretKey, "credentials-secret-key", controllers.DefaultCredentialsSecretKey,
+		"Key of the provider credentials in the credentials secret.")
+	flag.StringVar(&providerConfigVariants, "provider-config-variants", "",
+		"YAML or JSON list of additional provider configs per cluster, each with a name suffix, an optional role template and an optional assumeRoleChain.")
+	flag.StringVar(&sharedProviderConfig, "shared-provider-config", string(controllers.SharedProviderConfigDisabled),
+		"Provider config shared by the clusters of an AWS account, named account-<id>: Disabled, Alongside the cluster provider configs or Instead of them.")
+	flag.StringVar(&endpoint, "endpoint", "",
+		"YAML or JSON endpoint override of the provider configs with url, optional services, hostnameImmutable and signingRegion, e.g. for LocalStack or VPC endpoints.")
+	flag.StringVar(&propagateLabels, "propagate-labels", "",
+		"Comma separated Cluster label keys copied to the generated objects. Keys ending in * match a prefix, e.g. release.giantswarm.io/*.")
+	flag.StringVar(&propagateAnnotations, "propagate-annotations", "",
+		"Comma separated Cluster annotation keys copied to the generated objects. Keys ending in * match a prefix.")
+	flag.StringVar(&valuesTemplatesDir, "values-templates-dir", "",
+		"Directory with Go templates rendered into additional config map keys, one file per key.")
+	flag.StringVar(&outputFormats, "output-formats", "",
+		"Comma separated list of additional config map formats: json, flat, env.")
+	flag.StringVar(&namespaces, "namespaces", "",
+		"Comma separated namespaces of the reconciled clusters, all namespaces when empty.")
+	flag.StringVar(&clusterSelector, "cluster-selector", "",
+		"Label selector of the reconciled clusters, e.g. giantswarm.io/organization=acme.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "c612f06f.my.domain",
+		"Name of the leader election lease, has to be unique per operator instance in a namespace.")
 	opts := zap.Options{
 		Development: false,
 		TimeEncoder: zapcore.RFC3339TimeEncoder,
@@ -76,27 +156,122 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	scope, err := controllers.ParseClusterScope(namespaces, clusterSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid cluster scope")
+		os.Exit(1)
+	}
+
+	var config controllers.OperatorConfig
+	if configPath != "" {
+		if flags := setSettingsFlags(); len(flags) > 0 {
+			setupLog.Error(nil, "settings flags can not be combined with the operator config file", "flags", flags)
+			os.Exit(1)
+		}
+		config, err = controllers.LoadOperatorConfig(configPath)
+		if err != nil {
+			setupLog.Error(err, "unable to load operator config")
+			os.Exit(1)
+		}
+	} else {
+		variants, err := controllers.ParseProviderConfigVariants(providerConfigVariants)
+		if err != nil {
+			setupLog.Error(err, "invalid provider config variants")
+			os.Exit(1)
+		}
+		endpointConfig, err := controllers.ParseEndpointConfig(endpoint)
+		if err != nil {
+			setupLog.Error(err, "invalid endpoint config")
+			os.Exit(1)
+		}
+		config = controllers.OperatorConfig{
+			APIVersion:   controllers.OperatorConfigAPIVersion,
+			Kind:         controllers.OperatorConfigKind,
+			ProviderRole: providerRoleARN,
+			BaseDomain:   baseDomain,
+			ConfigMap: controllers.ConfigMapSettings{
+				NameTemplate:      configMapNameTemplate,
+				NamespaceTemplate: configMapNamespaceTemplate,
+				AllowedNamespaces: strings.Split(configMapAllowedNamespaces, ","),
+			},
+			ProviderConfig: controllers.ProviderConfigSettings{
+				NameTemplate:         providerConfigNameTemplate,
+				API:                  providerConfigAPI,
+				CredentialsSource:    credentialsSource,
+				CredentialsSecret:    credentialsSecret,
+				CredentialsSecretKey: credentialsSecretKey,
+				Variants:             variants,
+				Shared:               sharedProviderConfig,
+				Endpoint:             endpointConfig,
+			},
+			EnvironmentConfig: controllers.EnvironmentConfigSettings{
+				NameTemplate: environmentConfigNameTemplate,
+			},
+			Propagation: controllers.PropagationSettings{
+				Labels:      strings.Split(propagateLabels, ","),
+				Annotations: strings.Split(propagateAnnotations, ","),
+			},
+			OutputFormats:      strings.Split(outputFormats, ","),
+			ValuesTemplatesDir: valuesTemplatesDir,
+		}
+	}
+
+	// Validate before connecting to the cluster, so a broken config fails
+	// right away with the actual problem
+	if err = config.Validate(); err != nil {
+		setupLog.Error(err, "invalid operator config, fix the flags or the config file")
+		os.Exit(1)
+	}
+	if err = scope.CheckConfigMapSettings(config.ConfigMap); err != nil {
+		setupLog.Error(err, "invalid operator config for the cluster scope, fix the flags or the config file")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
-		// MetricsBindAddress:     metricsAddr,
-		// Port:                   9443,
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "c612f06f.my.domain",
+		LeaderElectionID:       leaderElectionID,
+		Cache:                  scope.CacheOptions(),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ConfigMapReconciler{
-		Client:       mgr.GetClient(),
-		BaseDomain:   baseDomain,
-		ProviderRole: providerRoleARN,
-	}).SetupWithManager(mgr); err != nil {
+	reconciler := &controllers.ConfigMapReconciler{
+		Client:    mgr.GetClient(),
+		Scope:     scope,
+		APIReader: mgr.GetAPIReader(),
+		DryRun:    dryRun,
+		Recorder:  mgr.GetEventRecorderFor("aws-crossplane-cluster-config-operator"),
+	}
+	if dryRun {
+		setupLog.Info("dry run, changes are only reported")
+	}
+	if err = reconciler.ApplyOperatorConfig(config); err != nil {
+		setupLog.Error(err, "unable to apply operator config")
+		os.Exit(1)
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Frigate")
 		os.Exit(1)
 	}
+	if configPath != "" {
+		watcher := &controllers.OperatorConfigWatcher{
+			Path:       configPath,
+			Reconciler: reconciler,
+		}
+		if err = mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch operator config")
+			os.Exit(1)
+		}
+		if err = mgr.AddReadyzCheck("config", watcher.Check); err != nil {
+			setupLog.Error(err, "unable to set up config check")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -107,6 +282,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("provider-config-api", reconciler.ProviderConfigAPIChecker(mgr.GetRESTMapper())); err != nil {
+		setupLog.Error(err, "unable to set up provider config api check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -114,3 +293,36 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// settingsFlags are the flags covered by the operator config file.
+var settingsFlags = []string{
+	"provider-role",
+	"base-domain",
+	"config-map-name-template",
+	"config-map-namespace-template",
+	"config-map-allowed-namespaces",
+	"provider-config-name-template",
+	"environment-config-name-template",
+	"provider-config-api",
+	"credentials-source",
+	"credentials-secret",
+	"credentials-secret-key",
+	"provider-config-variants",
+	"shared-provider-config",
+	"endpoint",
+	"propagate-labels",
+	"propagate-annotations",
+	"values-templates-dir",
+	"output-formats",
+}
+
+// setSettingsFlags returns the settings flags given on the command line.
+func setSettingsFlags() []string {
+	set := []string{}
+	flag.Visit(func(f *flag.Flag) {
+		if slices.Contains(settingsFlags, f.Name) {
+			set = append(set, f.Name)
+		}
+	})
+	return set
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+const renderUsage = `Usage: %s render --config <operator config> <manifest>...
+
+Prints the objects the operator writes for the Clusters in the manifests, e.g.
+the ConfigMap and the ProviderConfigs, without a management cluster. The
+manifests hold the Clusters with their infrastructure, control plane and
+identity objects, "-" reads them from stdin.
+
+`
+
+// render runs the render subcommand and returns the exit code.
+func render(args []string) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), renderUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var configPath string
+	flags.StringVar(&configPath, "config", "", "Path of the operator config file.")
+	// Only errors are logged by default and in a readable form, the output
+	// goes to stdout
+	opts := zap.Options{
+		Development:     true,
+		Level:           zapcore.ErrorLevel,
+		StacktraceLevel: zapcore.PanicLevel,
+		TimeEncoder:     zapcore.RFC3339TimeEncoder,
+	}
+	opts.BindFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if configPath == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	renderLog := ctrl.Log.WithName("render")
+
+	config, err := controllers.LoadOperatorConfig(configPath)
+	if err != nil {
+		renderLog.Error(err, "invalid operator config")
+		return 1
+	}
+
+	objects := []*unstructured.Unstructured{}
+	for _, path := range flags.Args() {
+		manifests, err := readManifests(path)
+		if err != nil {
+			renderLog.Error(err, "unable to read manifests", "path", path)
+			return 1
+		}
+		objects = append(objects, manifests...)
+	}
+
+	rendered, err := controllers.Render(context.Background(), scheme, config, objects)
+	if err != nil {
+		renderLog.Error(err, "unable to render")
+		return 1
+	}
+
+	if err = controllers.WriteManifests(os.Stdout, rendered); err != nil {
+		renderLog.Error(err, "unable to write output")
+		return 1
+	}
+
+	return 0
+}
+
+func readManifests(path string) ([]*unstructured.Unstructured, error) {
+	if path == "-" {
+		return controllers.ReadManifests(os.Stdin)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return controllers.ReadManifests(file)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap/zapcore"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/giantswarm/aws-crossplane-cluster-config-operator/controllers"
+)
+
+const verifyUsage = `Usage: %s verify --config <operator config> [flags]
+
+Compares the objects the operator generates for every AWS cluster with the
+live objects of the management cluster and reports changed, missing and
+orphaned objects and inconsistent finalizers. Nothing is written. Exits with
+1 on drift and 2 on errors.
+
+`
+
+// verify runs the verify subcommand and returns the exit code.
+func verify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), verifyUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var configPath string
+	var output string
+	var namespaces string
+	var clusterSelector string
+	flags.StringVar(&configPath, "config", "", "Path of the operator config file.")
+	flags.StringVar(&output, "output", "table", "Output format: table or json.")
+	flags.StringVar(&namespaces, "namespaces", "",
+		"Comma separated namespaces of the verified clusters, all namespaces when empty.")
+	flags.StringVar(&clusterSelector, "cluster-selector", "",
+		"Label selector of the verified clusters.")
+	// The kubeconfig flag of controller-runtime, used by ctrl.GetConfig
+	if kubeconfig := flag.CommandLine.Lookup("kubeconfig"); kubeconfig != nil {
+		flags.Var(kubeconfig.Value, kubeconfig.Name, kubeconfig.Usage)
+	}
+	// Only errors are logged by default and in a readable form, the report
+	// goes to stdout
+	opts := zap.Options{
+		Development:     true,
+		Level:           zapcore.ErrorLevel,
+		StacktraceLevel: zapcore.PanicLevel,
+		TimeEncoder:     zapcore.RFC3339TimeEncoder,
+	}
+	opts.BindFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if configPath == "" || flags.NArg() > 0 || (output != "table" && output != "json") {
+		flags.Usage()
+		return 2
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	verifyLog := ctrl.Log.WithName("verify")
+
+	config, err := controllers.LoadOperatorConfig(configPath)
+	if err != nil {
+		verifyLog.Error(err, "invalid operator config")
+		return 2
+	}
+
+	scope, err := controllers.ParseClusterScope(namespaces, clusterSelector)
+	if err != nil {
+		verifyLog.Error(err, "invalid cluster scope")
+		return 2
+	}
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		verifyLog.Error(err, "unable to load kubeconfig")
+		return 2
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		verifyLog.Error(err, "unable to create client")
+		return 2
+	}
+
+	drifts, err := controllers.Verify(context.Background(), c, config, scope)
+	if err != nil {
+		verifyLog.Error(err, "unable to verify clusters")
+		return 2
+	}
+
+	if output == "json" {
+		err = writeDriftsJSON(os.Stdout, drifts)
+	} else {
+		err = writeDriftsTable(os.Stdout, drifts)
+	}
+	if err != nil {
+		verifyLog.Error(err, "unable to write report")
+		return 2
+	}
+
+	if len(drifts) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func writeDriftsJSON(w io.Writer, drifts []controllers.Drift) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(drifts)
+}
+
+func writeDriftsTable(w io.Writer, drifts []controllers.Drift) error {
+	if len(drifts) == 0 {
+		_, err := fmt.Fprintln(w, "No drift found.")
+		return err
+	}
+
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "CLUSTER\tTYPE\tKIND\tOBJECT\tDETAILS")
+	for _, drift := range drifts {
+		details := drift.Message
+		if len(drift.Fields) > 0 {
+			details = strings.TrimPrefix(details+", changing "+strings.Join(drift.Fields, ", "), ", ")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", drift.Cluster, drift.Type, drift.Kind, drift.Object, details)
+	}
+	return table.Flush()
+}